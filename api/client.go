@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -14,16 +18,27 @@ import (
 	"github.com/horockey/go-toolbox/http_helpers"
 	controller_dto "github.com/horockey/service_discovery/internal/controller/http_controller/dto"
 	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/signature"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	healthEndpoint = "/health"
 	updEndpoint    = "/updateMe"
+
+	indexHeader   = "X-Discovery-Index"
+	watchWait     = time.Second * 30
+	watchRetryIvl = time.Millisecond * 500
 )
 
 type Node = controller_dto.Node
 
+var tracer = otel.Tracer("github.com/horockey/service_discovery/api")
+
 type Client struct {
 	nodeID      string
 	cl          *resty.Client
@@ -33,6 +48,18 @@ type Client struct {
 	done chan struct{}
 
 	serv *http.Server
+
+	secretMu sync.RWMutex
+	secret   string
+	verifier *signature.Verifier
+
+	query []QueryOption
+
+	heartbeat    bool
+	heartbeatTTL time.Duration
+	statusMu     sync.Mutex
+	status       CheckStatus
+	note         string
 }
 
 func NewClient(
@@ -41,20 +68,33 @@ func NewClient(
 	apiKey string,
 	serv *http.Server,
 	logger zerolog.Logger,
+	opts ...Option,
 ) (*Client, error) {
-	if serv == nil {
-		return nil, errors.New("got nil serv")
-	}
-	return &Client{
+	cl := &Client{
 		serviceName: serviceName,
 		logger:      logger,
 		cl: resty.New().
 			SetBaseURL(baseURL).
 			SetHeader("X-Api-Key", apiKey).
-			SetRetryCount(3),
-		serv: serv,
-		done: make(chan struct{}),
-	}, nil
+			SetRetryCount(3).
+			OnBeforeRequest(injectTrace),
+		serv:     serv,
+		done:     make(chan struct{}),
+		status:   CheckStatusPassing,
+		verifier: signature.NewVerifier(),
+	}
+	for _, opt := range opts {
+		opt(cl)
+	}
+
+	if cl.heartbeat && cl.heartbeatTTL < MinHeartbeatTTL {
+		return nil, fmt.Errorf("heartbeat ttl must be at least %s, got: %s", MinHeartbeatTTL, cl.heartbeatTTL)
+	}
+	if serv == nil && !cl.heartbeat {
+		return nil, errors.New("got nil serv")
+	}
+
+	return cl, nil
 }
 
 func (cl *Client) Register(
@@ -67,26 +107,106 @@ func (cl *Client) Register(
 		return errors.New("got nil callback")
 	}
 
+	cl.secretMu.RLock()
+	secret := cl.secret
+	cl.secretMu.RUnlock()
+
+	regReq := controller_dto.RegisterNodeRequest{
+		ID:          cl.nodeID,
+		Hostname:    hostname,
+		ServiceName: cl.serviceName,
+		Meta:        meta,
+		Secret:      secret,
+	}
+	if cl.heartbeatTTL > 0 {
+		regReq.Check = &controller_dto.Check{
+			Kind:    model.CheckKindTtl.String(),
+			TTLMSec: int(cl.heartbeatTTL.Milliseconds()),
+		}
+	} else {
+		cl.mountHandlers(updCb)
+		regReq.HealthEndpoint = fmt.Sprintf("http://%s%s", hostname, healthEndpoint)
+		regReq.UpdEndpoint = fmt.Sprintf("http://%s%s", hostname, updEndpoint)
+	}
+
+	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetBody(regReq).
+		Post("/node")
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	regResp := controller_dto.RegisterNodeResponse{}
+	if err := json.Unmarshal(resp.Body(), &regResp); err != nil {
+		return fmt.Errorf("unmarshaling json: %w", err)
+	}
+
+	cl.nodeID = regResp.ID
+	cl.secretMu.Lock()
+	cl.secret = regResp.Secret
+	cl.secretMu.Unlock()
+
+	if cl.heartbeatTTL > 0 {
+		go cl.runHeartbeats(ctx)
+	}
+
+	go cl.watch(ctx, updCb)
+
+	return nil
+}
+
+func (cl *Client) mountHandlers(updCb func(Node) error) {
 	router := mux.NewRouter()
 	if cl.serv.Handler != nil {
 		router.NotFoundHandler = cl.serv.Handler
 	}
 
-	router.HandleFunc(healthEndpoint, func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc(healthEndpoint, func(w http.ResponseWriter, req *http.Request) {
+		if !cl.verify(w, req, nil) {
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		_, span := tracer.Start(ctx, "discovery.health", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
 		w.WriteHeader(http.StatusOK)
 	}).Methods(http.MethodGet)
 
 	router.HandleFunc(updEndpoint, func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			err = fmt.Errorf("reading body: %w", err)
+			cl.logger.Error().Err(err).Send()
+			_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !cl.verify(w, req, body) {
+			return
+		}
+
+		// Update continues trace of the node change in discovery.
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		_, span := tracer.Start(ctx, "discovery.update", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
 		n := controller_dto.Node{}
-		if err := json.NewDecoder(req.Body).Decode(&n); err != nil {
+		if err := json.Unmarshal(body, &n); err != nil {
 			err = fmt.Errorf("decoding json: %w", err)
 			cl.logger.Error().Err(err).Send()
 			_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
 			return
 		}
-		_ = req.Body.Close()
 
 		if err := updCb(n); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 			cl.logger.
 				Error().
 				Err(fmt.Errorf("running upd callback: %w", err)).
@@ -97,65 +217,97 @@ func (cl *Client) Register(
 	}).Methods(http.MethodPost)
 
 	cl.serv.Handler = router
+}
 
-	resp, err := cl.cl.R().
-		SetContext(ctx).
-		SetBody(controller_dto.RegisterNodeRequest{
-			Hostname:       hostname,
-			ServiceName:    cl.serviceName,
-			HealthEndpoint: fmt.Sprintf("http://%s%s", hostname, healthEndpoint),
-			UpdEndpoint:    fmt.Sprintf("http://%s%s", hostname, updEndpoint),
-			Meta:           meta,
-		}).
-		Post("/node")
-	if err != nil {
-		return fmt.Errorf("executing request: %w", err)
-	}
-	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+// verify checks that request was made by discovery and is not a replay.
+// Responds with 403 and returns false otherwise.
+func (cl *Client) verify(w http.ResponseWriter, req *http.Request, body []byte) bool {
+	// Handlers are mounted before registration completes,
+	// so there is nothing to verify against yet.
+	cl.secretMu.RLock()
+	secret := cl.secret
+	cl.secretMu.RUnlock()
+
+	if secret == "" {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, errors.New("node is not registered yet"))
+		return false
 	}
 
-	node := controller_dto.Node{}
-	if err := json.Unmarshal(resp.Body(), &node); err != nil {
-		return fmt.Errorf("unmarshaling json: %w", err)
+	if err := cl.verifier.Verify(secret, req, body, time.Now()); err != nil {
+		err = fmt.Errorf("verifying request signature: %w", err)
+		cl.logger.Warn().Err(err).Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusForbidden, err)
+		return false
 	}
 
-	cl.nodeID = node.ID
+	return true
+}
 
+// watch follows nodes of the service with blocking queries,
+// calling updCb for every added, removed or changed node.
+// Nodes which stop matching client query are reported as removed.
+func (cl *Client) watch(ctx context.Context, updCb func(Node) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	go func() {
-		ticker := time.NewTicker(time.Millisecond * 500)
-		defer ticker.Stop()
-		nodes, _ := cl.GetNodes(ctx)
+		select {
+		case <-cl.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	nodes, index, _ := cl.getNodes(ctx, 0)
+
+	for {
+		newNodes, newIndex, err := cl.getNodes(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			cl.logger.
+				Error().
+				Err(fmt.Errorf("getting nodes: %w", err)).
+				Send()
+		}
 
-		for {
+		// Requests must not be repeated in a tight loop if they fail
+		// or server does not support blocking queries.
+		if err != nil || newIndex == 0 {
 			select {
-			case <-cl.done:
+			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				newNodes, _ := cl.GetNodes(ctx)
-
-				for _, node := range nodes {
-					if !slices.ContainsFunc(newNodes, func(el Node) bool { return el.ID == node.ID }) {
-						// downed
-						node.State = model.StateDown.String()
-						_ = updCb(node)
-					}
-				}
-
-				for _, node := range newNodes {
-					if !slices.ContainsFunc(nodes, func(el Node) bool { return el.ID == node.ID }) {
-						// upped
-						node.State = model.StateUp.String()
-						_ = updCb(node)
-					}
-				}
-
-				nodes = newNodes
+			case <-time.After(watchRetryIvl):
 			}
 		}
-	}()
+		if err != nil {
+			continue
+		}
 
-	return nil
+		for _, node := range nodes {
+			if !slices.ContainsFunc(newNodes, func(el Node) bool { return el.ID == node.ID }) {
+				// removed
+				node.State = model.StateDown.String()
+				node.Event = model.EventKindRemoved.String()
+				_ = updCb(node)
+			}
+		}
+
+		for _, node := range newNodes {
+			idx := slices.IndexFunc(nodes, func(el Node) bool { return el.ID == node.ID })
+			switch {
+			case idx == -1 || nodes[idx].State != node.State || nodes[idx].Damped != node.Damped:
+				// added or changed
+				node.Event = model.EventKindUpdated.String()
+				_ = updCb(node)
+			case !maps.Equal(nodes[idx].Meta, node.Meta):
+				node.Event = model.EventKindMetaChanged.String()
+				_ = updCb(node)
+			}
+		}
+
+		nodes, index = newNodes, newIndex
+	}
 }
 
 func (cl *Client) Deregister(ctx context.Context) error {
@@ -175,22 +327,105 @@ func (cl *Client) Deregister(ctx context.Context) error {
 	return nil
 }
 
-func (cl *Client) GetNodes(ctx context.Context) ([]Node, error) {
+// EnterMaintenance takes registered node out of rotation,
+// e.g. before restart. Zero dur means no automatic expiry.
+func (cl *Client) EnterMaintenance(ctx context.Context, reason string, dur time.Duration) error {
+	return cl.setMaintenance(ctx, controller_dto.MaintenanceRequest{
+		Enable:       true,
+		Reason:       reason,
+		DurationMSec: int(dur.Milliseconds()),
+	})
+}
+
+// ExitMaintenance returns registered node to rotation.
+func (cl *Client) ExitMaintenance(ctx context.Context) error {
+	return cl.setMaintenance(ctx, controller_dto.MaintenanceRequest{})
+}
+
+func (cl *Client) setMaintenance(ctx context.Context, req controller_dto.MaintenanceRequest) error {
 	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetPathParam("nodeID", cl.nodeID).
+		SetBody(req).
+		Put("/node/{nodeID}/maintenance")
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+// UpdateMeta sets keys of set and deletes keys of del in meta of the registered node.
+// Other nodes of the service are notified with meta-changed event.
+func (cl *Client) UpdateMeta(ctx context.Context, set map[string]string, del ...string) error {
+	patch := map[string]*string{}
+	for k, v := range set {
+		patch[k] = &v
+	}
+	for _, k := range del {
+		patch[k] = nil
+	}
+
+	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetPathParam("nodeID", cl.nodeID).
+		SetBody(patch).
+		Patch("/node/{nodeID}/meta")
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+// GetNodes returns nodes of the service matching client query and opts.
+func (cl *Client) GetNodes(ctx context.Context, opts ...QueryOption) ([]Node, error) {
+	nodes, _, err := cl.getNodes(ctx, 0, opts...)
+	return nodes, err
+}
+
+// getNodes returns nodes of the service along with their revision.
+// Non-zero index makes request block until revision gets greater than index.
+func (cl *Client) getNodes(ctx context.Context, index uint64, opts ...QueryOption) ([]Node, uint64, error) {
+	req := cl.cl.R().
 		SetContext(ctx).
 		SetPathParam("serviceName", cl.serviceName).
-		Get("/node/{serviceName}")
+		SetQueryParams(newQuery(append(slices.Clone(cl.query), opts...)).params())
+	if index > 0 {
+		req.SetQueryParams(map[string]string{
+			"index": strconv.FormatUint(index, 10),
+			"wait":  watchWait.String(),
+		})
+	}
+
+	resp, err := req.Get("/node/{serviceName}")
 	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
+		return nil, 0, fmt.Errorf("executing request: %w", err)
 	}
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+		return nil, 0, fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
 	}
 
 	nodes := []controller_dto.Node{}
 	if err := json.Unmarshal(resp.Body(), &nodes); err != nil {
-		return nil, fmt.Errorf("unmarshaling json: %w", err)
+		return nil, 0, fmt.Errorf("unmarshaling json: %w", err)
 	}
 
-	return nodes, nil
+	// Missing header means server does not support blocking queries.
+	newIndex, _ := strconv.ParseUint(resp.Header().Get(indexHeader), 10, 64)
+
+	return nodes, newIndex, nil
+}
+
+// injectTrace propagates trace of the request context to discovery.
+// It is no-op unless propagator is set up with otel.SetTextMapPropagator.
+func injectTrace(_ *resty.Client, req *resty.Request) error {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return nil
 }
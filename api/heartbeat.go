@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	controller_dto "github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type CheckStatus = model.CheckStatus
+
+const (
+	CheckStatusPassing  = model.CheckStatusPassing
+	CheckStatusWarning  = model.CheckStatusWarning
+	CheckStatusCritical = model.CheckStatusCritical
+)
+
+// SetStatus sets node health reported by subsequent heartbeats.
+func (cl *Client) SetStatus(status CheckStatus, note string) {
+	cl.statusMu.Lock()
+	defer cl.statusMu.Unlock()
+
+	cl.status = status
+	cl.note = note
+}
+
+// Heartbeat immediately reports current node health to discovery.
+func (cl *Client) Heartbeat(ctx context.Context) error {
+	cl.statusMu.Lock()
+	req := controller_dto.HeartbeatRequest{
+		Status: cl.status.String(),
+		Note:   cl.note,
+	}
+	cl.statusMu.Unlock()
+
+	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetPathParam("nodeID", cl.nodeID).
+		SetBody(req).
+		Put("/node/{nodeID}/heartbeat")
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+func (cl *Client) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(cl.heartbeatTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := cl.Heartbeat(ctx); err != nil {
+			cl.logger.
+				Error().
+				Err(fmt.Errorf("sending heartbeat: %w", err)).
+				Send()
+		}
+
+		select {
+		case <-cl.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
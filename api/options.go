@@ -0,0 +1,40 @@
+package api
+
+import (
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Option func(*Client)
+
+// MinHeartbeatTTL is the least ttl accepted by WithHeartbeat.
+const MinHeartbeatTTL = model.MinTTL
+
+// WithHeartbeat makes client report node health to discovery
+// by heartbeats instead of serving health and update endpoints.
+// Node is considered failed if no heartbeat arrives within ttl,
+// which must be at least MinHeartbeatTTL.
+// Server passed to NewClient may be nil in this mode.
+func WithHeartbeat(ttl time.Duration) Option {
+	return func(cl *Client) {
+		cl.heartbeat = true
+		cl.heartbeatTTL = ttl
+	}
+}
+
+// WithNodeID makes client register node with the given ID.
+// Otherwise, discovery reuses ID of the node registered from the same host.
+func WithNodeID(id string) Option {
+	return func(cl *Client) {
+		cl.nodeID = id
+	}
+}
+
+// WithQuery makes client follow only nodes of the service matching opts.
+// The same opts are applied to GetNodes.
+func WithQuery(opts ...QueryOption) Option {
+	return func(cl *Client) {
+		cl.query = append(cl.query, opts...)
+	}
+}
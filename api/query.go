@@ -0,0 +1,62 @@
+package api
+
+import "strings"
+
+// AllDatacenters requests merged view of all federated datacenters.
+const AllDatacenters = "all"
+
+type query struct {
+	selectors  []string
+	states     []string
+	datacenter string
+}
+
+// QueryOption narrows down nodes returned by discovery.
+type QueryOption func(*query)
+
+// MatchSelector keeps nodes matching label selector over their Meta,
+// e.g. "zone=a,version!=2,shard in (1,2),canary,!legacy".
+// Multiple selectors must all match.
+func MatchSelector(selector string) QueryOption {
+	return func(q *query) {
+		q.selectors = append(q.selectors, selector)
+	}
+}
+
+// MatchStates keeps nodes in one of the given states, e.g. "up".
+func MatchStates(states ...string) QueryOption {
+	return func(q *query) {
+		q.states = append(q.states, states...)
+	}
+}
+
+// Datacenter requests nodes of the federated datacenter instead of the local one,
+// or of all of them with AllDatacenters. Nodes have their Datacenter set.
+// Merged view has no revision, so watching it falls back to polling.
+func Datacenter(dc string) QueryOption {
+	return func(q *query) {
+		q.datacenter = dc
+	}
+}
+
+func newQuery(opts []QueryOption) query {
+	q := query{}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+func (q query) params() map[string]string {
+	res := map[string]string{}
+	if len(q.selectors) > 0 {
+		res["selector"] = strings.Join(q.selectors, ",")
+	}
+	if len(q.states) > 0 {
+		res["state"] = strings.Join(q.states, ",")
+	}
+	if q.datacenter != "" {
+		res["dc"] = q.datacenter
+	}
+	return res
+}
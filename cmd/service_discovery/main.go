@@ -12,13 +12,26 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/cluster/raft_cluster"
 	"github.com/horockey/service_discovery/internal/config"
+	"github.com/horockey/service_discovery/internal/controller/dns_controller"
+	"github.com/horockey/service_discovery/internal/controller/grpc_controller"
 	"github.com/horockey/service_discovery/internal/controller/http_controller"
+	"github.com/horockey/service_discovery/internal/extractor/health_upds/cluster_health_upds"
 	"github.com/horockey/service_discovery/internal/extractor/health_upds/http_check_health_upds"
 	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates"
+	"github.com/horockey/service_discovery/internal/metrics"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
 	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/raft_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes/http_remote_nodes"
+	"github.com/horockey/service_discovery/internal/tracing"
 	"github.com/horockey/service_discovery/internal/usecase/discovery"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 )
 
 func main() {
@@ -35,6 +48,24 @@ func main() {
 			Send()
 	}
 
+	tp, err := tracing.New(cfg.TracesFile, "service_discovery")
+	if err != nil {
+		logger.
+			Fatal().
+			Err(fmt.Errorf("creating tracer provider: %w", err)).
+			Send()
+	}
+	defer func() {
+		sdCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if err := tp.Shutdown(sdCtx); err != nil {
+			logger.
+				Error().
+				Err(fmt.Errorf("shutting down tracer provider: %w", err)).
+				Send()
+		}
+	}()
+
 	if err := os.MkdirAll(cfg.BadgerDir, os.ModePerm); err != nil {
 		logger.
 			Fatal().
@@ -51,13 +82,114 @@ func main() {
 	}
 	defer db.Close()
 
-	nodesRepo := badger_nodes.New(
-		db,
-		time.Duration(cfg.DownNodesRmIvlMSec)*time.Millisecond,
+	downNodesRmDur := time.Duration(cfg.DownNodesRmIvlMSec) * time.Millisecond
+
+	var (
+		nodesRepo  nodes.Repository
+		outboxRepo outbox.Repository
+		cl         cluster.Cluster = cluster.Standalone{}
+		// leaderTasks are run by the leader only.
+		leaderTasks = map[string]func(ctx context.Context) error{}
 	)
 
+	if len(cfg.Cluster.Peers) == 0 {
+		nodesRepo, err = badger_nodes.New(db, downNodesRmDur)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating nodes repo: %w", err)).
+				Send()
+		}
+
+		outboxRepo, err = badger_outbox.New(db)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating outbox repo: %w", err)).
+				Send()
+		}
+	} else {
+		// Nodes are removed by the leader through the log,
+		// so local repo does not do it on its own.
+		localRepo, err := badger_nodes.New(db, 0)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating local nodes repo: %w", err)).
+				Send()
+		}
+
+		localOutbox, err := badger_outbox.New(db)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating local outbox repo: %w", err)).
+				Send()
+		}
+
+		fsm, err := raft_nodes.NewFSM(localRepo, localOutbox)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating nodes fsm: %w", err)).
+				Send()
+		}
+
+		raftCl, err := raft_cluster.New(
+			raft_cluster.Config{
+				ID:       cfg.Cluster.ID,
+				BindAddr: cfg.Cluster.RaftBindAddr,
+				Dir:      cfg.Cluster.RaftDir,
+				Peers: lo.Map(cfg.Cluster.Peers, func(el config.Peer, _ int) cluster.Peer {
+					return cluster.Peer(el)
+				}),
+			},
+			fsm,
+			cfg.APIKey,
+			logger.With().Str("scope", "cluster").Logger(),
+		)
+		if err != nil {
+			logger.
+				Fatal().
+				Err(fmt.Errorf("creating cluster: %w", err)).
+				Send()
+		}
+		defer func() {
+			if err := raftCl.Close(); err != nil {
+				logger.
+					Error().
+					Err(fmt.Errorf("closing cluster: %w", err)).
+					Send()
+			}
+		}()
+
+		raftRepo := raft_nodes.New(fsm, raftCl, downNodesRmDur)
+		nodesRepo, cl = raftRepo, raftCl
+		outboxRepo = raft_nodes.NewOutbox(fsm, raftCl)
+		leaderTasks["nodes expiry"] = raftRepo.Start
+	}
+
+	if err := metrics.RegisterNodes(nodesRepo); err != nil {
+		logger.
+			Fatal().
+			Err(fmt.Errorf("registering nodes metrics: %w", err)).
+			Send()
+	}
+	if err := metrics.RegisterBadger(db); err != nil {
+		logger.
+			Fatal().
+			Err(fmt.Errorf("registering badger metrics: %w", err)).
+			Send()
+	}
+
 	updsGw, err := http_broadcast_nodes_updates.New(
 		runtime.NumCPU(),
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{
+			Min: time.Duration(cfg.UpdsBackoffMinMSec) * time.Millisecond,
+			Max: time.Duration(cfg.UpdsBackoffMaxMSec) * time.Millisecond,
+		},
+		time.Duration(cfg.UpdsMaxAgeMSec)*time.Millisecond,
 		logger.With().Str("scope", "http_updates_gateway").Logger(),
 	)
 	if err != nil {
@@ -68,10 +200,22 @@ func main() {
 	}
 
 	updsExtr, err := http_check_health_upds.New(
-		nodesRepo,
+		cluster.ShardNodes(nodesRepo, cl),
 		100,
 		time.Duration(cfg.HealthcheckIvlMsec)*time.Millisecond,
-		cfg.APIKey,
+		cfg.HealthcheckWorkersNum,
+		http_check_health_upds.Thresholds(cfg.HealthcheckThresholds),
+		lo.MapValues(
+			cfg.ServiceHealthcheckThresholds,
+			func(th config.Thresholds, _ string) http_check_health_upds.Thresholds {
+				return http_check_health_upds.Thresholds(th)
+			},
+		),
+		http_check_health_upds.FlapDamping{
+			Window:    time.Duration(cfg.FlapWindowMSec) * time.Millisecond,
+			Threshold: cfg.FlapThreshold,
+		},
+		cfg.ExecCheckCommands,
 		logger.With().Str("scope", "healthcheck_extractor").Logger(),
 	)
 	if err != nil {
@@ -81,20 +225,82 @@ func main() {
 			Send()
 	}
 
+	clusterUpdsExtr, err := cluster_health_upds.New(
+		updsExtr,
+		cl,
+		100,
+		logger.With().Str("scope", "cluster_healthcheck_extractor").Logger(),
+	)
+	if err != nil {
+		logger.
+			Fatal().
+			Err(fmt.Errorf("creating cluster healthcheck extractor: %w", err)).
+			Send()
+	}
+
+	remoteRepo, err := http_remote_nodes.New(
+		lo.Map(cfg.Federation, func(el config.FederationPeer, _ int) http_remote_nodes.Peer {
+			return http_remote_nodes.Peer{
+				Datacenter: el.Datacenter,
+				URL:        el.URL,
+				APIKey:     lo.CoalesceOrEmpty(el.APIKey, cfg.APIKey),
+			}
+		}),
+		time.Duration(cfg.FederationMaxStalenessMSec)*time.Millisecond,
+		logger.With().Str("scope", "remote_nodes").Logger(),
+	)
+	if err != nil {
+		logger.
+			Fatal().
+			Err(fmt.Errorf("creating remote nodes repo: %w", err)).
+			Send()
+	}
+
 	uc := discovery.New(
 		nodesRepo,
-		updsExtr,
+		outboxRepo,
+		remoteRepo,
+		clusterUpdsExtr,
 		updsGw,
+		cfg.Datacenter,
+		time.Duration(cfg.DrainPeriodMSec)*time.Millisecond,
 		logger.With().Str("scope", "usecase").Logger(),
 	)
+	leaderTasks["maintenance"] = uc.StartMaintenance
+	// Outbox is replicated, but changed through the log, so it is only filled and drained by the leader.
+	leaderTasks["updates gateway"] = updsGw.Start
 
 	ctrl := http_controller.New(
 		cfg.BaseURL,
 		uc,
+		cl,
 		cfg.APIKey,
+		cfg.MetricsProtected,
 		logger.With().Str("scope", "http_controller").Logger(),
 	)
 
+	grpcCtrl := grpc_controller.New(
+		cfg.GRPCBaseURL,
+		uc,
+		cl,
+		cfg.APIKey,
+		logger.With().Str("scope", "grpc_controller").Logger(),
+	)
+
+	dnsCtrl := dns_controller.New(
+		cfg.DNSBaseURL,
+		cfg.DNSDomain,
+		time.Duration(cfg.DNSTTLSec)*time.Second,
+		lo.MapValues(
+			cfg.ServiceDNSTTLSec,
+			func(ttl int, _ string) time.Duration {
+				return time.Duration(ttl) * time.Second
+			},
+		),
+		uc,
+		logger.With().Str("scope", "dns_controller").Logger(),
+	)
+
 	ctx, cancel := signal.NotifyContext(
 		context.Background(),
 		syscall.SIGTERM,
@@ -110,10 +316,10 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := updsGw.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		if err := updsExtr.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			logger.
 				Error().
-				Err(fmt.Errorf("running updates gateway: %w", err)).
+				Err(fmt.Errorf("running updates extractor: %w", err)).
 				Send()
 			cancel()
 		}
@@ -122,10 +328,22 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := updsExtr.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		if err := clusterUpdsExtr.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			logger.
 				Error().
-				Err(fmt.Errorf("running updates extractor: %w", err)).
+				Err(fmt.Errorf("running cluster updates extractor: %w", err)).
+				Send()
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := remoteRepo.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.
+				Error().
+				Err(fmt.Errorf("running remote nodes repo: %w", err)).
 				Send()
 			cancel()
 		}
@@ -143,6 +361,20 @@ func main() {
 		}
 	}()
 
+	for name, task := range leaderTasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cl.RunLeader(ctx, task); err != nil && !errors.Is(err, context.Canceled) {
+				logger.
+					Error().
+					Err(fmt.Errorf("running %s on leader: %w", name, err)).
+					Send()
+				cancel()
+			}
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -155,6 +387,30 @@ func main() {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := grpcCtrl.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.
+				Error().
+				Err(fmt.Errorf("running grpc controller: %w", err)).
+				Send()
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := dnsCtrl.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.
+				Error().
+				Err(fmt.Errorf("running dns controller: %w", err)).
+				Send()
+			cancel()
+		}
+	}()
+
 	logger.Info().Msg("Service started")
 	wg.Wait()
 	logger.Info().Msg("Service stopped")
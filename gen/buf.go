@@ -0,0 +1,3 @@
+package gen
+
+//go:generate buf generate --template ../api/proto/buf.gen.yaml ../api/proto
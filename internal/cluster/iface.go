@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+// PathPrefix is prefix of http endpoints used by replicas to talk to each other.
+const PathPrefix = "/cluster/"
+
+var (
+	ErrNotLeader = errors.New("replica is not the leader")
+	ErrNoLeader  = errors.New("cluster has no leader")
+)
+
+// Peer is discovery replica.
+type Peer struct {
+	ID       string
+	RaftAddr string
+	HTTPAddr string
+	GRPCAddr string
+}
+
+type Cluster interface {
+	Self() Peer
+	// Members returns live replicas, as seen by the leader.
+	Members() []Peer
+	IsLeader() bool
+	// Leader returns the current leader, or ErrNoLeader during election.
+	Leader() (Peer, error)
+	// Sync blocks until local state includes all writes
+	// committed by the leader before the call.
+	Sync(ctx context.Context) error
+	// RunLeader runs fn each time replica becomes the leader,
+	// with context which is done on leadership loss,
+	// until ctx is done or fn fails.
+	RunLeader(ctx context.Context, fn func(ctx context.Context) error) error
+	// ForwardUpd sends node health update made by the replica to the leader.
+	ForwardUpd(ctx context.Context, upd model.Node) error
+	// ForwardedUpds emits node health updates sent to the leader by other replicas.
+	ForwardedUpds() <-chan model.Node
+	// Handler serves endpoints under PathPrefix.
+	Handler() http.Handler
+}
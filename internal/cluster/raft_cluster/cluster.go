@@ -0,0 +1,411 @@
+package raft_cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var _ cluster.Cluster = &raftCluster{}
+
+const (
+	readIndexPath = cluster.PathPrefix + "read_index"
+	membersPath   = cluster.PathPrefix + "members"
+	updsPath      = cluster.PathPrefix + "health_upds"
+
+	applyTimeout     = time.Second * 10
+	transportTimeout = time.Second * 10
+	transportPool    = 3
+	snapshotsRetain  = 2
+	syncPollIvl      = time.Millisecond * 10
+	membersSyncIvl   = time.Second
+	updsChSize       = 100
+	// observationsChSize is big enough for the observer not to drop any,
+	// as heartbeat failures are observed with backoff.
+	observationsChSize = 64
+)
+
+type Config struct {
+	ID string
+	// BindAddr is address raft transport listens on.
+	// Address advertised to other replicas is RaftAddr of the peer with ID.
+	BindAddr string
+	Dir      string
+	// Peers are all replicas of the cluster, including this one.
+	Peers []cluster.Peer
+}
+
+type readIndex struct {
+	Index uint64 `json:"index"`
+}
+
+type raftCluster struct {
+	cfg       Config
+	self      cluster.Peer
+	raft      *raft.Raft
+	fsm       *indexedFSM
+	transport *raft.NetworkTransport
+	store     *raftboltdb.BoltStore
+	cl        *resty.Client
+	logger    zerolog.Logger
+	upds      chan model.Node
+
+	membersMu sync.RWMutex
+	members   []cluster.Peer
+
+	mu sync.Mutex
+	// changed is closed and replaced on each leadership change.
+	changed chan struct{}
+	done    chan struct{}
+
+	barrierMu sync.Mutex
+	// barrierFor is leadership changed chan of the term
+	// in which the leader has applied all previous entries.
+	barrierFor <-chan struct{}
+}
+
+// New starts raft replica applying committed entries to fsm.
+// Cluster of cfg.Peers is bootstrapped if replica has no state yet.
+func New(
+	cfg Config,
+	fsm raft.FSM,
+	apiKey string,
+	logger zerolog.Logger,
+) (*raftCluster, error) {
+	self, found := lo.Find(cfg.Peers, func(el cluster.Peer) bool { return el.ID == cfg.ID })
+	if !found {
+		return nil, fmt.Errorf("replica %s is not among peers", cfg.ID)
+	}
+
+	advertise, err := net.ResolveTCPAddr("tcp", self.RaftAddr)
+	if err != nil {
+		return nil, fmt.Errorf("resolving raft addr %s: %w", self.RaftAddr, err)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("making dir %s: %w", cfg.Dir, err)
+	}
+
+	raftLogger := hclog.New(&hclog.LoggerOptions{
+		Name:   "raft",
+		Level:  hclog.Warn,
+		Output: logger,
+	})
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+	if err != nil {
+		return nil, fmt.Errorf("creating bolt store: %w", err)
+	}
+
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(cfg.Dir, snapshotsRetain, raftLogger)
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("creating snapshot store: %w", err)
+	}
+
+	transport, err := raft.NewTCPTransportWithLogger(cfg.BindAddr, advertise, transportPool, transportTimeout, raftLogger)
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("creating transport: %w", err)
+	}
+
+	notifyCh := make(chan bool, 1)
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.Logger = raftLogger
+	conf.NotifyCh = notifyCh
+
+	cl := &raftCluster{
+		cfg:       cfg,
+		self:      self,
+		fsm:       &indexedFSM{fsm: fsm},
+		members:   cfg.Peers,
+		upds:      make(chan model.Node, updsChSize),
+		transport: transport,
+		store:     store,
+		logger:    logger,
+		changed:   make(chan struct{}),
+		done:      make(chan struct{}),
+		cl: resty.New().
+			SetHeader("X-Api-Key", apiKey),
+	}
+
+	hasState, err := raft.HasExistingState(store, store, snaps)
+	if err != nil {
+		_ = transport.Close()
+		_ = store.Close()
+		return nil, fmt.Errorf("checking existing state: %w", err)
+	}
+
+	if ra, ok := fsm.(ReplayAware); ok {
+		lastIndex, err := store.LastIndex()
+		if err != nil {
+			_ = transport.Close()
+			_ = store.Close()
+			return nil, fmt.Errorf("getting last log index: %w", err)
+		}
+		ra.SetReplayIndex(lastIndex)
+	}
+
+	cl.raft, err = raft.NewRaft(conf, cl.fsm, store, store, snaps, transport)
+	if err != nil {
+		_ = transport.Close()
+		_ = store.Close()
+		return nil, fmt.Errorf("creating raft: %w", err)
+	}
+
+	if !hasState {
+		servers := lo.Map(cfg.Peers, func(el cluster.Peer, _ int) raft.Server {
+			return raft.Server{
+				ID:      raft.ServerID(el.ID),
+				Address: raft.ServerAddress(el.RaftAddr),
+			}
+		})
+		// Every replica bootstraps with the same configuration,
+		// so the one losing the race is not an error.
+		err := cl.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			_ = cl.Close()
+			return nil, fmt.Errorf("bootstrapping cluster: %w", err)
+		}
+	}
+
+	obsCh := make(chan raft.Observation, observationsChSize)
+	cl.raft.RegisterObserver(raft.NewObserver(obsCh, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.LeaderObservation, raft.FailedHeartbeatObservation, raft.ResumedHeartbeatObservation:
+			return true
+		default:
+			return false
+		}
+	}))
+
+	go cl.watchLeadership(notifyCh)
+	go cl.watchMembers(obsCh)
+
+	return cl, nil
+}
+
+// Close stops the replica. The rest of cluster elects new leader if needed.
+func (cl *raftCluster) Close() error {
+	var resErr error
+	if err := cl.raft.Shutdown().Error(); err != nil {
+		resErr = errors.Join(resErr, fmt.Errorf("shutting down raft: %w", err))
+	}
+	close(cl.done)
+
+	if err := cl.transport.Close(); err != nil {
+		resErr = errors.Join(resErr, fmt.Errorf("closing transport: %w", err))
+	}
+	if err := cl.store.Close(); err != nil {
+		resErr = errors.Join(resErr, fmt.Errorf("closing store: %w", err))
+	}
+
+	return resErr
+}
+
+// Apply commits data to the log and returns response of fsm applying it.
+// It fails with cluster.ErrNotLeader on other replicas.
+func (cl *raftCluster) Apply(_ context.Context, data []byte) (any, error) {
+	f := cl.raft.Apply(data, applyTimeout)
+	if err := f.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return nil, fmt.Errorf("%w: %w", cluster.ErrNotLeader, err)
+		}
+		return nil, fmt.Errorf("applying to raft: %w", err)
+	}
+
+	return f.Response(), nil
+}
+
+func (cl *raftCluster) IsLeader() bool {
+	return cl.raft.State() == raft.Leader
+}
+
+func (cl *raftCluster) Leader() (cluster.Peer, error) {
+	_, id := cl.raft.LeaderWithID()
+	peer, found := lo.Find(cl.cfg.Peers, func(el cluster.Peer) bool { return raft.ServerID(el.ID) == id })
+	if id == "" || !found {
+		return cluster.Peer{}, cluster.ErrNoLeader
+	}
+
+	return peer, nil
+}
+
+// Sync waits for local state to catch up with read index of the leader.
+func (cl *raftCluster) Sync(ctx context.Context) error {
+	if cl.IsLeader() {
+		if _, err := cl.readIndex(); err != nil {
+			return fmt.Errorf("getting read index: %w", err)
+		}
+		return nil
+	}
+
+	leader, err := cl.Leader()
+	if err != nil {
+		return fmt.Errorf("getting leader: %w", err)
+	}
+
+	idx := readIndex{}
+	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetResult(&idx).
+		ForceContentType("application/json").
+		Get("http://" + leader.HTTPAddr + readIndexPath)
+	if err != nil {
+		return fmt.Errorf("requesting read index from leader: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("requesting read index from leader: got %d status code: %s", resp.StatusCode(), resp.String())
+	}
+
+	ticker := time.NewTicker(syncPollIvl)
+	defer ticker.Stop()
+
+	for cl.fsm.index.Load() < idx.Index {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("running context: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+func (cl *raftCluster) RunLeader(ctx context.Context, fn func(ctx context.Context) error) error {
+	for {
+		changed, leader := cl.leadership()
+		if !leader {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("running context: %w", ctx.Err())
+			case <-changed:
+				continue
+			}
+		}
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			defer cancel()
+			for leader {
+				select {
+				case <-leaderCtx.Done():
+					return
+				case <-changed:
+					changed, leader = cl.leadership()
+				}
+			}
+		}()
+
+		err := fn(leaderCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("running context: %w", ctx.Err())
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+}
+
+func (cl *raftCluster) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+readIndexPath, cl.handleGetReadIndex)
+	mux.HandleFunc("GET "+membersPath, cl.handleGetMembers)
+	mux.HandleFunc("POST "+updsPath, cl.handlePostUpds)
+	return mux
+}
+
+func (cl *raftCluster) handleGetReadIndex(w http.ResponseWriter, _ *http.Request) {
+	idx, err := cl.readIndex()
+	if err != nil {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, fmt.Errorf("getting read index: %w", err))
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, readIndex{Index: idx})
+}
+
+// readIndex returns index of the last entry applied by the leader,
+// which confirms its leadership first. All acknowledged writes are applied up to it.
+func (cl *raftCluster) readIndex() (uint64, error) {
+	changed, _ := cl.leadership()
+	if err := cl.verifyLeader(); err != nil {
+		return 0, fmt.Errorf("verifying leadership: %w", err)
+	}
+
+	// New leader may have entries of previous terms committed but not applied yet,
+	// so it waits for them once per term.
+	cl.barrierMu.Lock()
+	defer cl.barrierMu.Unlock()
+	if cl.barrierFor != changed {
+		if err := cl.raft.Barrier(applyTimeout).Error(); err != nil {
+			if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+				return 0, fmt.Errorf("%w: %w", cluster.ErrNotLeader, err)
+			}
+			return 0, fmt.Errorf("applying barrier: %w", err)
+		}
+		cl.barrierFor = changed
+	}
+
+	return cl.fsm.index.Load(), nil
+}
+
+func (cl *raftCluster) verifyLeader() error {
+	if err := cl.raft.VerifyLeader().Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return fmt.Errorf("%w: %w", cluster.ErrNotLeader, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// leadership returns whether replica is the leader,
+// along with channel closed on the next change of it.
+func (cl *raftCluster) leadership() (<-chan struct{}, bool) {
+	// Channel is taken before reading state,
+	// so that change made in between is not missed.
+	cl.mu.Lock()
+	changed := cl.changed
+	cl.mu.Unlock()
+
+	return changed, cl.IsLeader()
+}
+
+func (cl *raftCluster) watchLeadership(notifyCh <-chan bool) {
+	for {
+		select {
+		case <-cl.done:
+			return
+		case leader := <-notifyCh:
+			cl.logger.
+				Info().
+				Bool("leader", leader).
+				Msg("Leadership changed")
+
+			cl.mu.Lock()
+			close(cl.changed)
+			cl.changed = make(chan struct{})
+			cl.mu.Unlock()
+		}
+	}
+}
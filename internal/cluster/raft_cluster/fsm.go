@@ -0,0 +1,76 @@
+package raft_cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/hashicorp/raft"
+)
+
+// ReplayAware is fsm told index of the last entry in the log on start.
+// Entries up to it are replayed from the log rather than newly committed.
+type ReplayAware interface {
+	raft.FSM
+	SetReplayIndex(index uint64)
+}
+
+// indexedFSM tracks index of the last entry applied to fsm.
+// Raft applied index can't be used for reads, as it moves
+// before entries are applied to fsm asynchronously.
+type indexedFSM struct {
+	fsm   raft.FSM
+	index atomic.Uint64
+}
+
+func (f *indexedFSM) Apply(l *raft.Log) any {
+	res := f.fsm.Apply(l)
+	f.index.Store(l.Index)
+
+	return res
+}
+
+// Snapshot is called on fsm goroutine, so index matches snapshot state.
+func (f *indexedFSM) Snapshot() (raft.FSMSnapshot, error) {
+	snap, err := f.fsm.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return indexedSnapshot{snap: snap, index: f.index.Load()}, nil
+}
+
+func (f *indexedFSM) Restore(rc io.ReadCloser) error {
+	var index uint64
+	if err := binary.Read(rc, binary.BigEndian, &index); err != nil {
+		_ = rc.Close()
+		return fmt.Errorf("reading snapshot index: %w", err)
+	}
+
+	if err := f.fsm.Restore(rc); err != nil {
+		return err
+	}
+	f.index.Store(index)
+
+	return nil
+}
+
+// indexedSnapshot is fsm snapshot prefixed with its index.
+type indexedSnapshot struct {
+	snap  raft.FSMSnapshot
+	index uint64
+}
+
+func (s indexedSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := binary.Write(sink, binary.BigEndian, s.index); err != nil {
+		_ = sink.Cancel()
+		return fmt.Errorf("writing snapshot index: %w", err)
+	}
+
+	return s.snap.Persist(sink)
+}
+
+func (s indexedSnapshot) Release() {
+	s.snap.Release()
+}
@@ -0,0 +1,124 @@
+package raft_cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/samber/lo"
+)
+
+func (cl *raftCluster) Self() cluster.Peer {
+	return cl.self
+}
+
+func (cl *raftCluster) Members() []cluster.Peer {
+	cl.membersMu.RLock()
+	defer cl.membersMu.RUnlock()
+
+	return slices.Clone(cl.members)
+}
+
+// watchMembers keeps track of live replicas. The leader learns it
+// from heartbeats to other replicas, which learn it from the leader.
+func (cl *raftCluster) watchMembers(obsCh <-chan raft.Observation) {
+	down := map[string]bool{}
+	ticker := time.NewTicker(membersSyncIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cl.done:
+			return
+
+		case o := <-obsCh:
+			switch data := o.Data.(type) {
+			case raft.LeaderObservation:
+				// New leader knows nothing about other replicas yet,
+				// so they are considered live until heartbeat fails.
+				if data.LeaderID == raft.ServerID(cl.self.ID) {
+					clear(down)
+				}
+			case raft.FailedHeartbeatObservation:
+				down[string(data.PeerID)] = true
+			case raft.ResumedHeartbeatObservation:
+				delete(down, string(data.PeerID))
+			}
+
+			if cl.IsLeader() {
+				cl.setMembers(lo.Filter(cl.cfg.Peers, func(el cluster.Peer, _ int) bool {
+					return !down[el.ID]
+				}))
+			}
+
+		case <-ticker.C:
+			if cl.IsLeader() {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), membersSyncIvl)
+			ids, err := cl.leaderMembers(ctx)
+			cancel()
+			if err != nil {
+				cl.logger.
+					Warn().
+					Err(fmt.Errorf("getting members from leader: %w", err)).
+					Send()
+				continue
+			}
+
+			cl.setMembers(lo.Filter(cl.cfg.Peers, func(el cluster.Peer, _ int) bool {
+				return slices.Contains(ids, el.ID)
+			}))
+		}
+	}
+}
+
+func (cl *raftCluster) setMembers(members []cluster.Peer) {
+	cl.membersMu.Lock()
+	defer cl.membersMu.Unlock()
+
+	if !slices.Equal(cl.members, members) {
+		cl.logger.
+			Info().
+			Strs("members", lo.Map(members, func(el cluster.Peer, _ int) string { return el.ID })).
+			Msg("Live members changed")
+	}
+	cl.members = members
+}
+
+func (cl *raftCluster) leaderMembers(ctx context.Context) ([]string, error) {
+	leader, err := cl.Leader()
+	if err != nil {
+		return nil, fmt.Errorf("getting leader: %w", err)
+	}
+
+	ids := []string{}
+	resp, err := cl.cl.R().
+		SetContext(ctx).
+		SetResult(&ids).
+		ForceContentType("application/json").
+		Get("http://" + leader.HTTPAddr + membersPath)
+	if err != nil {
+		return nil, fmt.Errorf("requesting leader: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("requesting leader: got %d status code: %s", resp.StatusCode(), resp.String())
+	}
+
+	return ids, nil
+}
+
+func (cl *raftCluster) handleGetMembers(w http.ResponseWriter, _ *http.Request) {
+	if !cl.IsLeader() {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, cluster.ErrNotLeader)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, lo.Map(cl.Members(), func(el cluster.Peer, _ int) string { return el.ID }))
+}
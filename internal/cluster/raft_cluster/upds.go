@@ -0,0 +1,63 @@
+package raft_cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func (cl *raftCluster) ForwardUpd(ctx context.Context, upd model.Node) error {
+	leader, err := cl.Leader()
+	if err != nil {
+		return fmt.Errorf("getting leader: %w", err)
+	}
+
+	req := cl.cl.R().
+		SetContext(ctx).
+		SetBody(upd)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := req.Post("http://" + leader.HTTPAddr + updsPath)
+	if err != nil {
+		return fmt.Errorf("requesting leader: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("requesting leader: got %d status code: %s", resp.StatusCode(), resp.String())
+	}
+
+	return nil
+}
+
+func (cl *raftCluster) ForwardedUpds() <-chan model.Node {
+	return cl.upds
+}
+
+func (cl *raftCluster) handlePostUpds(w http.ResponseWriter, req *http.Request) {
+	if !cl.IsLeader() {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, cluster.ErrNotLeader)
+		return
+	}
+
+	upd := model.Node{}
+	if err := json.NewDecoder(req.Body).Decode(&upd); err != nil {
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, fmt.Errorf("unmarshalling body json: %w", err))
+		return
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	upd.Trace = tracing.Inject(ctx)
+
+	select {
+	case cl.upds <- upd:
+		_ = http_helpers.RespondOK(w, nil)
+	case <-req.Context().Done():
+	}
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"strconv"
+)
+
+// ringVNodes is number of points each member takes on the ring,
+// so that keys are spread evenly.
+const ringVNodes = 128
+
+// ring is consistent hash ring, which moves only keys of the member
+// joining or leaving it to other members.
+type ring struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+func newRing(members []string) ring {
+	r := ring{owners: map[uint64]string{}}
+	for _, m := range members {
+		for i := range ringVNodes {
+			p := hash(m + "#" + strconv.Itoa(i))
+			r.points = append(r.points, p)
+			r.owners[p] = m
+		}
+	}
+	slices.Sort(r.points)
+
+	return r
+}
+
+// owner returns member owning the key, or empty string for empty ring.
+func (r ring) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	idx, _ := slices.BinarySearch(r.points, hash(key))
+	if idx == len(r.points) {
+		idx = 0
+	}
+
+	return r.owners[r.points[idx]]
+}
+
+// hash is cryptographic one, as faster hashes spread similar keys,
+// such as vnodes of a member, unevenly.
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
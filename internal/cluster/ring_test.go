@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	const keysNum = 3000
+
+	full := newRing([]string{"a", "b", "c"})
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for i := range keysNum {
+		key := "node" + strconv.Itoa(i)
+		owners[key] = full.owner(key)
+		counts[owners[key]]++
+	}
+
+	assert.Len(t, counts, 3)
+	for m, cnt := range counts {
+		assert.InDelta(t, keysNum/3, cnt, keysNum/10, m)
+	}
+
+	// Only keys of the leaving member move.
+	partial := newRing([]string{"a", "b"})
+	for key, owner := range owners {
+		if owner != "c" {
+			assert.Equal(t, owner, partial.owner(key), key)
+		} else {
+			assert.NotEqual(t, "c", partial.owner(key), key)
+		}
+	}
+
+	assert.Empty(t, newRing(nil).owner("node0"))
+}
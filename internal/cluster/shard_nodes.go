@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/samber/lo"
+)
+
+type NodesLister interface {
+	GetAll(ctx context.Context) ([]model.Node, error)
+	Revision(ctx context.Context, serviceName string) (uint64, error)
+}
+
+type shardNodes struct {
+	repo    NodesLister
+	cluster Cluster
+}
+
+// ShardNodes lists nodes owned by the replica, which are spread between
+// live replicas by node ID, so that work done for each listed node
+// is not repeated by the whole cluster.
+func ShardNodes(repo NodesLister, cluster Cluster) *shardNodes {
+	return &shardNodes{
+		repo:    repo,
+		cluster: cluster,
+	}
+}
+
+func (sn *shardNodes) GetAll(ctx context.Context) ([]model.Node, error) {
+	all, err := sn.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	self := sn.cluster.Self().ID
+	r := newRing(lo.Map(sn.cluster.Members(), func(el Peer, _ int) string { return el.ID }))
+
+	return lo.Filter(all, func(el model.Node, _ int) bool {
+		return r.owner(el.ID) == self
+	}), nil
+}
+
+// Revision is not sharded, as it is not changed by changes of members.
+func (sn *shardNodes) Revision(ctx context.Context, serviceName string) (uint64, error) {
+	return sn.repo.Revision(ctx, serviceName)
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+var _ Cluster = Standalone{}
+
+// Standalone is cluster of the single replica, which is always the leader.
+type Standalone struct{}
+
+func (Standalone) Self() Peer {
+	return Peer{}
+}
+
+func (Standalone) Members() []Peer {
+	return []Peer{{}}
+}
+
+func (Standalone) IsLeader() bool {
+	return true
+}
+
+func (Standalone) Leader() (Peer, error) {
+	return Peer{}, nil
+}
+
+func (Standalone) Sync(_ context.Context) error {
+	return nil
+}
+
+func (Standalone) RunLeader(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// ForwardUpd is never needed, as the only replica is the leader.
+func (Standalone) ForwardUpd(_ context.Context, _ model.Node) error {
+	return errors.New("standalone replica has no other leader")
+}
+
+func (Standalone) ForwardedUpds() <-chan model.Node {
+	return nil
+}
+
+func (Standalone) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
@@ -11,20 +11,99 @@ import (
 )
 
 type Config struct {
-	BadgerDir          string `yaml:"badger_dir"`
-	DownNodesRmIvlMSec int    `yaml:"down_nodes_rm_ivl_msec"`
-	HealthcheckIvlMsec int    `yaml:"healthcheck_ivl_msec"`
-	BaseURL            string `yaml:"base_url"`
+	BadgerDir             string         `yaml:"badger_dir"`
+	DownNodesRmIvlMSec    int            `yaml:"down_nodes_rm_ivl_msec"`
+	HealthcheckIvlMsec    int            `yaml:"healthcheck_ivl_msec"`
+	HealthcheckWorkersNum int            `yaml:"healthcheck_workers_num"`
+	BaseURL               string         `yaml:"base_url"`
+	GRPCBaseURL           string         `yaml:"grpc_base_url"`
+	DNSBaseURL            string         `yaml:"dns_base_url"`
+	DNSDomain             string         `yaml:"dns_domain"`
+	DNSTTLSec             int            `yaml:"dns_ttl_sec"`
+	ServiceDNSTTLSec      map[string]int `yaml:"service_dns_ttl_sec"`
+
+	HealthcheckThresholds        Thresholds            `yaml:"healthcheck_thresholds"`
+	ServiceHealthcheckThresholds map[string]Thresholds `yaml:"service_healthcheck_thresholds"`
+	FlapWindowMSec               int                   `yaml:"flap_window_msec"`
+	FlapThreshold                int                   `yaml:"flap_threshold"`
+	DrainPeriodMSec              int                   `yaml:"drain_period_msec"`
+	ExecCheckCommands            [][]string            `yaml:"exec_check_commands"`
+
+	UpdsBackoffMinMSec int `yaml:"upds_backoff_min_msec"`
+	UpdsBackoffMaxMSec int `yaml:"upds_backoff_max_msec"`
+	UpdsMaxAgeMSec     int `yaml:"upds_max_age_msec"`
+
+	MetricsProtected bool   `yaml:"metrics_protected"`
+	TracesFile       string `yaml:"traces_file"`
+
+	Cluster Cluster `yaml:"cluster"`
+
+	Datacenter                 string           `yaml:"datacenter"`
+	Federation                 []FederationPeer `yaml:"federation"`
+	FederationMaxStalenessMSec int              `yaml:"federation_max_staleness_msec"`
 
 	APIKey string `env:"SERVICE_DISCOVERY_API_KEY"`
 }
 
+// Cluster is replication of discovery state between replicas.
+// Discovery runs standalone if no peers are set.
+type Cluster struct {
+	ID           string `yaml:"id"`
+	RaftBindAddr string `yaml:"raft_bind_addr"`
+	RaftDir      string `yaml:"raft_dir"`
+	Peers        []Peer `yaml:"peers"`
+}
+
+type Peer struct {
+	ID       string `yaml:"id"`
+	RaftAddr string `yaml:"raft_addr"`
+	HTTPAddr string `yaml:"http_addr"`
+	GRPCAddr string `yaml:"grpc_addr"`
+}
+
+// FederationPeer is discovery of the remote datacenter.
+// Own API key is used for it if APIKey is empty.
+type FederationPeer struct {
+	Datacenter string `yaml:"datacenter"`
+	URL        string `yaml:"url"`
+	APIKey     string `yaml:"api_key"`
+}
+
+type Thresholds struct {
+	Fail    int `yaml:"fail"`
+	Success int `yaml:"success"`
+}
+
 func New(logger zerolog.Logger) (*Config, error) {
 	cfg := Config{
-		BadgerDir:          "./badger",
-		DownNodesRmIvlMSec: 3_000,
-		HealthcheckIvlMsec: 1_000,
-		BaseURL:            "0.0.0.0:6500",
+		BadgerDir:             "./badger",
+		DownNodesRmIvlMSec:    3_000,
+		HealthcheckIvlMsec:    1_000,
+		HealthcheckWorkersNum: 64,
+		BaseURL:               "0.0.0.0:6500",
+		GRPCBaseURL:           "0.0.0.0:6501",
+		DNSBaseURL:            "0.0.0.0:8600",
+		DNSDomain:             "discovery",
+		DNSTTLSec:             5,
+		HealthcheckThresholds: Thresholds{
+			Fail:    3,
+			Success: 2,
+		},
+		FlapWindowMSec:  60_000,
+		FlapThreshold:   4,
+		DrainPeriodMSec: 5_000,
+
+		UpdsBackoffMinMSec: 500,
+		UpdsBackoffMaxMSec: 60_000,
+		UpdsMaxAgeMSec:     3_600_000,
+
+		Cluster: Cluster{
+			RaftBindAddr: "0.0.0.0:6502",
+			RaftDir:      "./raft",
+		},
+
+		Datacenter:                 "dc1",
+		FederationMaxStalenessMSec: 300_000,
 	}
 
 	if err := godotenv.Load(); err != nil {
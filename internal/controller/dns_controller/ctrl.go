@@ -0,0 +1,263 @@
+package dns_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+const (
+	serviceLabel = "service"
+	nodeLabel    = "node"
+
+	queryTimeout = time.Second * 2
+)
+
+type dnsController struct {
+	addr        string
+	domain      string
+	ttl         time.Duration
+	serviceTTLs map[string]time.Duration
+	uc          *discovery.Usecase
+	logger      zerolog.Logger
+}
+
+// New creates controller answering queries for names
+// <service>.service.<domain> and <node id>.node.<domain>.
+// Only nodes in up state are resolved.
+func New(
+	addr string,
+	domain string,
+	ttl time.Duration,
+	serviceTTLs map[string]time.Duration,
+	uc *discovery.Usecase,
+	logger zerolog.Logger,
+) *dnsController {
+	return &dnsController{
+		addr:        addr,
+		domain:      strings.ToLower(dns.Fqdn(domain)),
+		ttl:         ttl,
+		serviceTTLs: serviceTTLs,
+		uc:          uc,
+		logger:      logger,
+	}
+}
+
+// Start serves queries both over udp and tcp.
+func (ctrl *dnsController) Start(ctx context.Context) (resErr error) {
+	pc, err := net.ListenPacket("udp", ctrl.addr)
+	if err != nil {
+		return fmt.Errorf("listening udp %s: %w", ctrl.addr, err)
+	}
+	defer pc.Close()
+
+	lis, err := net.Listen("tcp", ctrl.addr)
+	if err != nil {
+		return fmt.Errorf("listening tcp %s: %w", ctrl.addr, err)
+	}
+	defer lis.Close()
+
+	servs := []*dns.Server{
+		{PacketConn: pc, Handler: ctrl},
+		{Listener: lis, Handler: ctrl},
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	errCh := make(chan error, len(servs))
+	for _, serv := range servs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- serv.ActivateAndServe()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			resErr = fmt.Errorf("running context: %w", ctx.Err())
+		}
+	case err := <-errCh:
+		if err != nil {
+			resErr = fmt.Errorf("running dns server: %w", err)
+		}
+	}
+
+	// Servers which failed to start can not be shut down,
+	// so closing of listeners is relied upon instead.
+	_ = pc.Close()
+	_ = lis.Close()
+
+	return resErr
+}
+
+func (ctrl *dnsController) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := &dns.Msg{}
+	resp.SetReply(req)
+	resp.Authoritative = true
+
+	// Multiple questions in one query are not supported by resolvers in practice.
+	if len(req.Question) == 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancel()
+
+		if err := ctrl.answer(ctx, resp, req.Question[0]); err != nil {
+			ctrl.logger.
+				Error().
+				Str("name", req.Question[0].Name).
+				Err(fmt.Errorf("answering query: %w", err)).
+				Send()
+			resp.Rcode = dns.RcodeServerFailure
+		}
+	} else {
+		resp.Rcode = dns.RcodeFormatError
+	}
+
+	if err := w.WriteMsg(resp); err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("writing response: %w", err)).
+			Send()
+	}
+}
+
+func (ctrl *dnsController) answer(ctx context.Context, resp *dns.Msg, q dns.Question) error {
+	prefix, found := strings.CutSuffix(strings.ToLower(dns.Fqdn(q.Name)), "."+ctrl.domain)
+	if !found {
+		resp.Rcode = dns.RcodeRefused
+		return nil
+	}
+
+	labels := dns.SplitDomainName(prefix)
+	if len(labels) != 2 || (labels[1] != serviceLabel && labels[1] != nodeLabel) {
+		resp.Rcode = dns.RcodeNameError
+		return nil
+	}
+
+	nodes, _, err := ctrl.uc.GetAll(ctx, "", model.Selector{States: []model.State{model.StateUp}})
+	if err != nil {
+		return fmt.Errorf("getting nodes from usecase: %w", err)
+	}
+
+	// Resolvers may randomize case of the name, so it is matched case-insensitively.
+	nodes = lo.Filter(
+		nodes,
+		func(el model.Node, _ int) bool {
+			if labels[1] == nodeLabel {
+				return strings.EqualFold(el.ID, labels[0])
+			}
+			return strings.EqualFold(el.ServiceName, labels[0])
+		},
+	)
+	if len(nodes) == 0 {
+		resp.Rcode = dns.RcodeNameError
+		return nil
+	}
+
+	// Empty answer for unsupported types is a valid NODATA response.
+	switch q.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		for _, node := range nodes {
+			if rr := ctrl.addrRecord(q.Name, q.Qtype, node); rr != nil {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+
+	case dns.TypeSRV:
+		for _, node := range nodes {
+			host, port := splitHostname(node.Hostname)
+			if port == 0 {
+				continue
+			}
+
+			target := dns.Fqdn(host)
+			if net.ParseIP(host) != nil {
+				// SRV target must be a name, so node name is given,
+				// with its address in additional section.
+				target = ctrl.nodeName(node)
+				for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+					if rr := ctrl.addrRecord(target, qtype, node); rr != nil {
+						resp.Extra = append(resp.Extra, rr)
+					}
+				}
+			}
+
+			resp.Answer = append(resp.Answer, &dns.SRV{
+				Hdr:      ctrl.header(q.Name, dns.TypeSRV, node),
+				Priority: 1,
+				Weight:   1,
+				Port:     port,
+				Target:   target,
+			})
+		}
+	}
+
+	return nil
+}
+
+// addrRecord returns A or AAAA record for the node,
+// or nil if node address is not an IP of requested family.
+func (ctrl *dnsController) addrRecord(name string, qtype uint16, node model.Node) dns.RR {
+	host, _ := splitHostname(node.Hostname)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	ip4 := ip.To4()
+	switch {
+	case qtype == dns.TypeA && ip4 != nil:
+		return &dns.A{Hdr: ctrl.header(name, qtype, node), A: ip4}
+	case qtype == dns.TypeAAAA && ip4 == nil:
+		return &dns.AAAA{Hdr: ctrl.header(name, qtype, node), AAAA: ip}
+	default:
+		return nil
+	}
+}
+
+func (ctrl *dnsController) header(name string, rrtype uint16, node model.Node) dns.RR_Header {
+	ttl := ctrl.ttl
+	if serviceTTL, found := ctrl.serviceTTLs[node.ServiceName]; found {
+		ttl = serviceTTL
+	}
+
+	return dns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(ttl.Seconds()),
+	}
+}
+
+func (ctrl *dnsController) nodeName(node model.Node) string {
+	return strings.Join([]string{node.ID, nodeLabel, ctrl.domain}, ".")
+}
+
+// splitHostname splits node hostname into host and port.
+// Zero port is returned if hostname has none.
+func splitHostname(hostname string) (string, uint16) {
+	host, portStr, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return strings.Trim(hostname, "[]"), 0
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return host, 0
+	}
+
+	return host, uint16(port)
+}
@@ -0,0 +1,141 @@
+package dns_controller
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = zerolog.New(zerolog.ConsoleWriter{
+	Out:        os.Stdout,
+	TimeFormat: time.RFC3339,
+}).With().Timestamp().Logger()
+
+type chanUpds chan model.Node
+
+func (ch chanUpds) Out() <-chan model.Node { return ch }
+
+func TestController(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+	gw, err := http_broadcast_nodes_updates.New(
+		1,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Second, Max: time.Second},
+		time.Minute,
+		logger,
+	)
+	require.NoError(t, err)
+
+	upds := make(chanUpds)
+	uc := discovery.New(nodesRepo, outboxRepo, nil, upds, gw, "dc1", time.Second, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	go func() { _ = uc.Start(ctx) }()
+
+	register := func(hostname string, up bool) model.Node {
+		n, err := uc.Register(ctx, model.RegisterNodeRequest{
+			Hostname:    hostname,
+			ServiceName: "web",
+			Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+		})
+		require.NoError(t, err)
+		if up {
+			n.State = model.StateUp
+			upds <- n
+		}
+		return n
+	}
+	v4 := register("10.0.0.1:8080", true)
+	v6 := register("[::1]:8081", true)
+	register("db.local:5432", true)
+	register("10.0.0.2:8080", false)
+
+	require.Eventually(t, func() bool {
+		nodes, _, err := uc.GetAll(ctx, "web", model.Selector{})
+		require.NoError(t, err)
+		up := 0
+		for _, n := range nodes {
+			if n.State == model.StateUp {
+				up++
+			}
+		}
+		return up == 3
+	}, time.Second, time.Millisecond*10)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serv := &dns.Server{PacketConn: pc, Handler: New("", "discovery", time.Second*5, nil, uc, logger)}
+	go func() { _ = serv.ActivateAndServe() }()
+	defer serv.Shutdown()
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := &dns.Msg{}
+		req.SetQuestion(name, qtype)
+		resp, _, err := (&dns.Client{}).ExchangeContext(ctx, req, pc.LocalAddr().String())
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("a", func(t *testing.T) {
+		resp := query("WEB.service.discovery.", dns.TypeA)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+		assert.EqualValues(t, 5, resp.Answer[0].Header().Ttl)
+	})
+
+	t.Run("aaaa", func(t *testing.T) {
+		resp := query("web.service.discovery.", dns.TypeAAAA)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, "::1", resp.Answer[0].(*dns.AAAA).AAAA.String())
+	})
+
+	t.Run("srv", func(t *testing.T) {
+		resp := query("web.service.discovery.", dns.TypeSRV)
+		require.Len(t, resp.Answer, 3)
+
+		targets := map[string]uint16{}
+		for _, rr := range resp.Answer {
+			srv := rr.(*dns.SRV)
+			targets[srv.Target] = srv.Port
+		}
+		assert.Equal(t, map[string]uint16{
+			v4.ID + ".node.discovery.": 8080,
+			v6.ID + ".node.discovery.": 8081,
+			"db.local.":                5432,
+		}, targets)
+		assert.Len(t, resp.Extra, 2)
+	})
+
+	t.Run("node", func(t *testing.T) {
+		resp := query(v4.ID+".node.discovery.", dns.TypeA)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Equal(t, dns.RcodeNameError, query("db.service.discovery.", dns.TypeA).Rcode)
+		assert.Equal(t, dns.RcodeRefused, query("example.com.", dns.TypeA).Rcode)
+	})
+}
@@ -0,0 +1,109 @@
+package grpc_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/horockey/service_discovery/api/discoverypb"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// forwardedMetadata marks calls forwarded to the leader,
+// so that they are not forwarded again if leadership moved meanwhile.
+const forwardedMetadata = "x-discovery-forwarded"
+
+// leader returns client of the leader along with context to call it with,
+// or nil client if call is to be served locally.
+func (ctrl *grpcController) leader(ctx context.Context) (discoverypb.DiscoveryClient, context.Context, error) {
+	if ctrl.cluster.IsLeader() {
+		return nil, ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(forwardedMetadata)) > 0 {
+		return nil, nil, status.Error(codes.Unavailable, cluster.ErrNotLeader.Error())
+	}
+
+	peer, err := ctrl.cluster.Leader()
+	if err != nil {
+		return nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	conn, err := ctrl.conn(peer.GRPCAddr)
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Str("leader", peer.ID).
+			Err(fmt.Errorf("connecting to leader: %w", err)).
+			Send()
+		return nil, nil, status.Error(codes.Unavailable, "leader is unavailable")
+	}
+
+	// Only api key is passed on, as the rest of metadata is of the incoming connection.
+	outMD := metadata.Pairs(forwardedMetadata, "true")
+	outMD.Set(apiKeyMetadata, md.Get(apiKeyMetadata)...)
+
+	return discoverypb.NewDiscoveryClient(conn), metadata.NewOutgoingContext(ctx, outMD), nil
+}
+
+// conn returns connection to the replica, reusing it between calls.
+func (ctrl *grpcController) conn(addr string) (*grpc.ClientConn, error) {
+	ctrl.connsMu.Lock()
+	defer ctrl.connsMu.Unlock()
+
+	if conn, found := ctrl.conns[addr]; found {
+		return conn, nil
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	ctrl.conns[addr] = conn
+
+	return conn, nil
+}
+
+func (ctrl *grpcController) closeConns() {
+	ctrl.connsMu.Lock()
+	defer ctrl.connsMu.Unlock()
+
+	for addr, conn := range ctrl.conns {
+		_ = conn.Close()
+		delete(ctrl.conns, addr)
+	}
+}
+
+// relayWatch streams events of the watch made on the leader.
+func relayWatch(
+	ctx context.Context,
+	leader discoverypb.DiscoveryClient,
+	req *discoverypb.WatchRequest,
+	stream grpc.ServerStreamingServer[discoverypb.WatchEvent],
+) error {
+	remote, err := leader.Watch(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := remote.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(ev); err != nil {
+			return fmt.Errorf("sending event: %w", err)
+		}
+	}
+}
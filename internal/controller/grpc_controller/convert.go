@@ -0,0 +1,77 @@
+package grpc_controller
+
+import (
+	"fmt"
+
+	"github.com/horockey/service_discovery/api/discoverypb"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/samber/lo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const snapshotEvent = "snapshot"
+
+func newNode(n model.Node) *discoverypb.Node {
+	res := &discoverypb.Node{
+		Id:          n.ID,
+		Hostname:    n.Hostname,
+		ServiceName: n.ServiceName,
+		State:       n.State.String(),
+		Damped:      n.Damped,
+		Meta:        n.Meta,
+		Revision:    n.Revision,
+		Datacenter:  n.Datacenter,
+	}
+	if !n.ChangedAt.IsZero() {
+		res.ChangedAt = timestamppb.New(n.ChangedAt)
+	}
+	if n.Maintenance != nil {
+		res.Maintenance = &discoverypb.Maintenance{
+			Reason: n.Maintenance.Reason,
+			Since:  timestamppb.New(n.Maintenance.Since),
+		}
+		if !n.Maintenance.Until.IsZero() {
+			res.Maintenance.Until = timestamppb.New(n.Maintenance.Until)
+		}
+	}
+	if n.Heartbeat != nil {
+		res.Heartbeat = &discoverypb.Heartbeat{
+			At:     timestamppb.New(n.Heartbeat.At),
+			Status: n.Heartbeat.Status.String(),
+			Note:   n.Heartbeat.Note,
+		}
+	}
+
+	return res
+}
+
+func checkToModel(c *discoverypb.Check) (model.Check, error) {
+	if c == nil {
+		return model.Check{Kind: model.CheckKindHttp}, nil
+	}
+
+	kind := model.CheckKindHttp
+	if c.GetKind() != "" {
+		var err error
+		if kind, err = model.ParseCheckKind(c.GetKind()); err != nil {
+			return model.Check{}, fmt.Errorf("parsing check kind: %w", err)
+		}
+	}
+
+	return model.Check{
+		Kind:             kind,
+		Interval:         c.GetInterval().AsDuration(),
+		Timeout:          c.GetTimeout().AsDuration(),
+		Retries:          int(c.GetRetries()),
+		TTL:              c.GetTtl().AsDuration(),
+		Address:          c.GetAddress(),
+		GRPCService:      c.GetGrpcService(),
+		GRPCUseTLS:       c.GetGrpcUseTls(),
+		ExpectedStatuses: lo.Map(c.GetExpectedStatuses(), func(el int32, _ int) int { return int(el) }),
+		BodyMatch:        c.GetBodyMatch(),
+		Method:           c.GetMethod(),
+		Headers:          c.GetHeaders(),
+		TLSSkipVerify:    c.GetTlsSkipVerify(),
+		Command:          c.GetCommand(),
+	}, nil
+}
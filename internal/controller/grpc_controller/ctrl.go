@@ -0,0 +1,316 @@
+package grpc_controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/horockey/service_discovery/api/discoverypb"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const apiKeyMetadata = "x-api-key"
+
+type grpcController struct {
+	discoverypb.UnimplementedDiscoveryServer
+
+	addr    string
+	serv    *grpc.Server
+	uc      *discovery.Usecase
+	cluster cluster.Cluster
+	apiKey  string
+	logger  zerolog.Logger
+
+	// connsMu guards connections to other replicas, used for forwarding to the leader.
+	connsMu sync.Mutex
+	conns   map[string]*grpc.ClientConn
+}
+
+func New(
+	addr string,
+	uc *discovery.Usecase,
+	cl cluster.Cluster,
+	apiKey string,
+	logger zerolog.Logger,
+) *grpcController {
+	ctrl := &grpcController{
+		addr:    addr,
+		uc:      uc,
+		cluster: cl,
+		apiKey:  apiKey,
+		logger:  logger,
+		conns:   map[string]*grpc.ClientConn{},
+	}
+
+	ctrl.serv = grpc.NewServer(
+		grpc.UnaryInterceptor(ctrl.unaryAuthInterceptor),
+		grpc.StreamInterceptor(ctrl.streamAuthInterceptor),
+	)
+	discoverypb.RegisterDiscoveryServer(ctrl.serv, ctrl)
+
+	return ctrl
+}
+
+func (ctrl *grpcController) Start(ctx context.Context) (resErr error) {
+	lis, err := net.Listen("tcp", ctrl.addr)
+	if err != nil {
+		return fmt.Errorf("listening %s: %w", ctrl.addr, err)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer ctrl.closeConns()
+
+	errCh := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errCh <- ctrl.serv.Serve(lis)
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Watch streams are endless, so they are not waited for.
+		ctrl.serv.Stop()
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			resErr = fmt.Errorf("running context: %w", ctx.Err())
+		}
+
+	case err := <-errCh:
+		if err != nil {
+			resErr = fmt.Errorf("running grpc server: %w", err)
+		}
+	}
+
+	return resErr
+}
+
+func (ctrl *grpcController) Register(ctx context.Context, req *discoverypb.RegisterRequest) (*discoverypb.RegisterResponse, error) {
+	leader, fwdCtx, err := ctrl.leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if leader != nil {
+		return leader.Register(fwdCtx, req)
+	}
+
+	check, err := checkToModel(req.GetCheck())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("converting check: %s", err))
+	}
+
+	node, err := ctrl.uc.Register(ctx, model.RegisterNodeRequest{
+		ID:             req.GetId(),
+		Hostname:       req.GetHostname(),
+		ServiceName:    req.GetServiceName(),
+		HealthEndpoint: req.GetHealthEndpoint(),
+		UpdEndpoint:    req.GetUpdEndpoint(),
+		Meta:           req.GetMeta(),
+		Check:          check,
+		Secret:         req.GetSecret(),
+	})
+	if err != nil {
+		return nil, ctrl.usecaseErr(fmt.Errorf("registering in usecase: %w", err))
+	}
+
+	return &discoverypb.RegisterResponse{
+		Node:   newNode(node),
+		Secret: node.Secret,
+	}, nil
+}
+
+func (ctrl *grpcController) Deregister(ctx context.Context, req *discoverypb.DeregisterRequest) (*discoverypb.DeregisterResponse, error) {
+	leader, fwdCtx, err := ctrl.leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if leader != nil {
+		return leader.Deregister(fwdCtx, req)
+	}
+
+	if err := ctrl.uc.Deregister(ctx, req.GetNodeId()); err != nil {
+		return nil, ctrl.usecaseErr(fmt.Errorf("deregistering in usecase: %w", err))
+	}
+
+	return &discoverypb.DeregisterResponse{}, nil
+}
+
+func (ctrl *grpcController) List(ctx context.Context, req *discoverypb.ListRequest) (*discoverypb.ListResponse, error) {
+	sel, err := model.ParseSelector(req.GetSelector())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("parsing selector: %s", err))
+	}
+	for _, s := range req.GetStates() {
+		st, err := model.ParseState(s)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("parsing state: %s", err))
+		}
+		sel.States = append(sel.States, st)
+	}
+
+	if err := ctrl.cluster.Sync(ctx); err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("syncing with cluster: %w", err)).
+			Send()
+		return nil, status.Error(codes.Unavailable, "replica is out of sync with cluster")
+	}
+
+	nodes, rev, err := ctrl.uc.GetAllIn(ctx, req.GetDatacenter(), req.GetServiceName(), sel)
+	if err != nil {
+		return nil, ctrl.usecaseErr(fmt.Errorf("getting from usecase: %w", err))
+	}
+
+	return &discoverypb.ListResponse{
+		Nodes:    lo.Map(nodes, func(el model.Node, _ int) *discoverypb.Node { return newNode(el) }),
+		Revision: rev,
+	}, nil
+}
+
+func (ctrl *grpcController) Heartbeat(ctx context.Context, req *discoverypb.HeartbeatRequest) (*discoverypb.HeartbeatResponse, error) {
+	leader, fwdCtx, err := ctrl.leader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if leader != nil {
+		return leader.Heartbeat(fwdCtx, req)
+	}
+
+	st := model.CheckStatusPassing
+	if req.GetStatus() != "" {
+		var err error
+		if st, err = model.ParseCheckStatus(req.GetStatus()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("parsing status: %s", err))
+		}
+	}
+
+	node, err := ctrl.uc.Heartbeat(ctx, req.GetNodeId(), st, req.GetNote())
+	if err != nil {
+		return nil, ctrl.usecaseErr(fmt.Errorf("sending heartbeat to usecase: %w", err))
+	}
+
+	return &discoverypb.HeartbeatResponse{Node: newNode(node)}, nil
+}
+
+func (ctrl *grpcController) Watch(req *discoverypb.WatchRequest, stream grpc.ServerStreamingServer[discoverypb.WatchEvent]) error {
+	if req.GetServiceName() == "" {
+		return status.Error(codes.InvalidArgument, "missing service name")
+	}
+
+	ctx := stream.Context()
+	leader, fwdCtx, err := ctrl.leader(ctx)
+	if err != nil {
+		return err
+	}
+	if leader != nil {
+		return relayWatch(fwdCtx, leader, req, stream)
+	}
+
+	watch, err := ctrl.uc.Watch(ctx, req.GetServiceName(), req.GetSince())
+	if err != nil {
+		return ctrl.usecaseErr(fmt.Errorf("watching in usecase: %w", err))
+	}
+
+	if !watch.Resumed {
+		if err := stream.Send(&discoverypb.WatchEvent{
+			Kind:     snapshotEvent,
+			Revision: watch.Revision,
+			Nodes:    lo.Map(watch.Snapshot, func(el model.Node, _ int) *discoverypb.Node { return newNode(el) }),
+		}); err != nil {
+			return fmt.Errorf("sending snapshot: %w", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case ev, ok := <-watch.Events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher is not keeping up, resume from the last revision")
+			}
+			if ev.Node.Revision <= watch.Revision {
+				continue
+			}
+
+			if err := stream.Send(&discoverypb.WatchEvent{
+				Kind:     ev.Kind.String(),
+				Revision: ev.Node.Revision,
+				Node:     newNode(ev.Node),
+			}); err != nil {
+				return fmt.Errorf("sending event: %w", err)
+			}
+		}
+	}
+}
+
+func (ctrl *grpcController) unaryAuthInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := ctrl.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (ctrl *grpcController) streamAuthInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := ctrl.authenticate(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (ctrl *grpcController) authenticate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(apiKeyMetadata)
+	if len(keys) == 0 || subtle.ConstantTimeCompare([]byte(keys[0]), []byte(ctrl.apiKey)) != 1 {
+		ctrl.logger.Error().Err(errors.New("bad api key")).Send()
+		return status.Error(codes.PermissionDenied, "bad api key")
+	}
+	return nil
+}
+
+func (ctrl *grpcController) usecaseErr(err error) error {
+	ctrl.logger.Error().Err(err).Send()
+
+	switch {
+	case errors.Is(err, nodes.ErrNotFound):
+		return status.Error(codes.NotFound, nodes.ErrNotFound.Error())
+	case errors.Is(err, model.ErrInvalidStateTransition):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, model.ErrInvalidRequest):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, model.ErrSecretMismatch):
+		return status.Error(codes.PermissionDenied, model.ErrSecretMismatch.Error())
+	case errors.Is(err, cluster.ErrNotLeader):
+		return status.Error(codes.Unavailable, cluster.ErrNotLeader.Error())
+	case errors.Is(err, remote_nodes.ErrUnknownDatacenter):
+		return status.Error(codes.NotFound, remote_nodes.ErrUnknownDatacenter.Error())
+	case errors.Is(err, remote_nodes.ErrNotSynced):
+		return status.Error(codes.Unavailable, remote_nodes.ErrNotSynced.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
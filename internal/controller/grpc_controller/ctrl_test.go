@@ -0,0 +1,122 @@
+package grpc_controller
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/api/discoverypb"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const apiKey = "API_KEY"
+
+var logger = zerolog.New(zerolog.ConsoleWriter{
+	Out:        os.Stdout,
+	TimeFormat: time.RFC3339,
+}).With().Timestamp().Logger()
+
+type noUpds struct{}
+
+func (noUpds) Out() <-chan model.Node { return nil }
+
+func TestController(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+	gw, err := http_broadcast_nodes_updates.New(
+		1,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Second, Max: time.Second},
+		time.Minute,
+		logger,
+	)
+	require.NoError(t, err)
+
+	uc := discovery.New(nodesRepo, outboxRepo, nil, noUpds{}, gw, "dc1", time.Second, logger)
+	ctrl := New("", uc, cluster.Standalone{}, apiKey, logger)
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = ctrl.serv.Serve(lis) }()
+	defer ctrl.serv.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	cl := discoverypb.NewDiscoveryClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+
+	_, err = cl.List(ctx, &discoverypb.ListRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, apiKeyMetadata, apiKey)
+
+	stream, err := cl.Watch(ctx, &discoverypb.WatchRequest{ServiceName: "fooBarService"})
+	require.NoError(t, err)
+	ev, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, snapshotEvent, ev.GetKind())
+	assert.Empty(t, ev.GetNodes())
+
+	regResp, err := cl.Register(ctx, &discoverypb.RegisterRequest{
+		Hostname:    "node1",
+		ServiceName: "fooBarService",
+		Check: &discoverypb.Check{
+			Kind: model.CheckKindTtl.String(),
+			Ttl:  durationpb.New(time.Second),
+		},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, regResp.GetSecret())
+	assert.Equal(t, model.StateStarting.String(), regResp.GetNode().GetState())
+
+	ev, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, model.EventKindUpdated.String(), ev.GetKind())
+	assert.Equal(t, regResp.GetNode().GetId(), ev.GetNode().GetId())
+
+	_, err = cl.Heartbeat(ctx, &discoverypb.HeartbeatRequest{NodeId: regResp.GetNode().GetId()})
+	require.NoError(t, err)
+
+	listResp, err := cl.List(ctx, &discoverypb.ListRequest{ServiceName: "fooBarService"})
+	require.NoError(t, err)
+	require.Len(t, listResp.GetNodes(), 1)
+	assert.Equal(t, ev.GetRevision(), listResp.GetRevision())
+
+	_, err = cl.Deregister(ctx, &discoverypb.DeregisterRequest{NodeId: "unknown_id"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = cl.Deregister(ctx, &discoverypb.DeregisterRequest{NodeId: regResp.GetNode().GetId()})
+	require.NoError(t, err)
+}
@@ -0,0 +1,40 @@
+package http_controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	indexHeader = "X-Discovery-Index"
+
+	defaultWait = time.Second * 30
+	maxWait     = time.Minute * 5
+)
+
+func parseBlockingQuery(req *http.Request) (uint64, time.Duration, error) {
+	query := req.URL.Query()
+
+	var index uint64
+	if s := query.Get("index"); s != "" {
+		var err error
+		if index, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("parsing index: %w", err)
+		}
+	}
+
+	wait := defaultWait
+	if s := query.Get("wait"); s != "" {
+		var err error
+		if wait, err = time.ParseDuration(s); err != nil {
+			return 0, 0, fmt.Errorf("parsing wait: %w", err)
+		}
+		if wait <= 0 {
+			return 0, 0, fmt.Errorf("wait must be positive, got: %s", wait)
+		}
+	}
+
+	return index, min(wait, maxWait), nil
+}
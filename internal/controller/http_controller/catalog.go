@@ -0,0 +1,65 @@
+package http_controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/samber/lo"
+)
+
+func (ctrl *httpController) handleGetService(w http.ResponseWriter, req *http.Request) {
+	services, err := ctrl.uc.Services(req.Context())
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("getting services from usecase: %w", err)).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, lo.Map(
+		services,
+		func(el model.Service, _ int) dto.Service {
+			return dto.NewService(el)
+		},
+	))
+}
+
+func (ctrl *httpController) handleGetServiceName(w http.ResponseWriter, req *http.Request) {
+	serviceName, found := mux.Vars(req)["serviceName"]
+	if !found {
+		err := errors.New("missing serviceName")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	service, nodes, err := ctrl.uc.Service(req.Context(), serviceName)
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("getting service from usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, dto.ServiceDetails{
+		Service: dto.NewService(service),
+		Nodes: lo.Map(
+			nodes,
+			func(el model.Node, _ int) dto.Node {
+				return dto.NewNode(el)
+			},
+		),
+	})
+}
@@ -0,0 +1,89 @@
+package http_controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// forwardedHeader marks requests forwarded to the leader,
+// so that they are not forwarded again if leadership moved meanwhile.
+const forwardedHeader = "X-Discovery-Forwarded"
+
+// clusterMiddleware forwards to the leader requests which change state
+// or need state kept by the leader only, and makes other reads consistent.
+func (ctrl *httpController) clusterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, cluster.PathPrefix):
+			next.ServeHTTP(w, req)
+
+		case leaderOnly(req):
+			if ctrl.cluster.IsLeader() {
+				next.ServeHTTP(w, req)
+				return
+			}
+			ctrl.forward(w, req)
+
+		default:
+			if err := ctrl.cluster.Sync(req.Context()); err != nil {
+				ctrl.logger.
+					Error().
+					Err(fmt.Errorf("syncing with cluster: %w", err)).
+					Send()
+				_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, errors.New("replica is out of sync with cluster"))
+				return
+			}
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// leaderOnly reports whether request is to be served by the leader.
+// Watch events and the outbox are kept by the leader only.
+func leaderOnly(req *http.Request) bool {
+	return req.Method != http.MethodGet ||
+		req.URL.Path == "/watch" ||
+		strings.HasPrefix(req.URL.Path, "/admin/")
+}
+
+func (ctrl *httpController) forward(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get(forwardedHeader) != "" {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, cluster.ErrNotLeader)
+		return
+	}
+
+	leader, err := ctrl.cluster.Leader()
+	if err != nil {
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(&url.URL{Scheme: "http", Host: leader.HTTPAddr})
+			r.SetXForwarded()
+			r.Out.Header.Set(forwardedHeader, "true")
+			otel.GetTextMapPropagator().Inject(r.Out.Context(), propagation.HeaderCarrier(r.Out.Header))
+		},
+		// Watch events are streamed as they come.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			ctrl.logger.
+				Error().
+				Str("leader", leader.ID).
+				Err(fmt.Errorf("forwarding request to leader: %w", err)).
+				Send()
+			_ = http_helpers.RespondWithErr(w, http.StatusBadGateway, errors.New("leader is unavailable"))
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
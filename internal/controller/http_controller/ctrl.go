@@ -5,45 +5,75 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/cluster"
 	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/metrics"
 	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
 	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 )
 
 type httpController struct {
-	serv   *http.Server
-	uc     *discovery.Usecase
-	logger zerolog.Logger
-	apiKey string
+	serv    *http.Server
+	uc      *discovery.Usecase
+	cluster cluster.Cluster
+	logger  zerolog.Logger
+	apiKey  string
 }
 
 func New(
 	addr string,
 	uc *discovery.Usecase,
+	cl cluster.Cluster,
 	apiKey string,
+	metricsProtected bool,
 	logger zerolog.Logger,
 ) *httpController {
 	ctrl := httpController{
-		uc:     uc,
-		logger: logger,
-		apiKey: apiKey,
-		serv:   &http.Server{Addr: addr},
+		uc:      uc,
+		cluster: cl,
+		logger:  logger,
+		apiKey:  apiKey,
+		serv:    &http.Server{Addr: addr},
 	}
 
 	router := mux.NewRouter()
-	router.HandleFunc("/node", ctrl.handlePostNode).Methods(http.MethodPost)
-	router.HandleFunc("/node", ctrl.handleGetNode).Methods(http.MethodGet)
-	router.HandleFunc("/node/{serviceName}", ctrl.handleGetNodeServiceName).Methods(http.MethodGet)
-	router.HandleFunc("/node/{nodeID}", ctrl.handleDeleteNodeId).Methods(http.MethodDelete)
-	router.Use(ctrl.authMiddleware)
+	router.Use(ctrl.metricsMiddleware, ctrl.tracingMiddleware)
+
+	var metricsHandler http.Handler = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+	if metricsProtected {
+		metricsHandler = ctrl.authMiddleware(metricsHandler)
+	}
+	router.Handle(metricsPath, metricsHandler).Methods(http.MethodGet)
+
+	api := router.NewRoute().Subrouter()
+	api.HandleFunc("/node", ctrl.handlePostNode).Methods(http.MethodPost)
+	api.HandleFunc("/node", ctrl.handleGetNode).Methods(http.MethodGet)
+	api.HandleFunc("/node/{serviceName}", ctrl.handleGetNodeServiceName).Methods(http.MethodGet)
+	api.HandleFunc("/node/{nodeID}", ctrl.handleDeleteNodeId).Methods(http.MethodDelete)
+	api.HandleFunc("/node/{nodeID}/maintenance", ctrl.handlePutNodeIdMaintenance).Methods(http.MethodPut)
+	api.HandleFunc("/node/{nodeID}/heartbeat", ctrl.handlePutNodeIdHeartbeat).Methods(http.MethodPut)
+	api.HandleFunc("/node/{nodeID}/meta", ctrl.handlePatchNodeIdMeta).Methods(http.MethodPatch)
+	api.HandleFunc("/node/{nodeID}/meta", ctrl.handlePutNodeIdMeta).Methods(http.MethodPut)
+	api.HandleFunc("/service", ctrl.handleGetService).Methods(http.MethodGet)
+	api.HandleFunc("/service/{serviceName}", ctrl.handleGetServiceName).Methods(http.MethodGet)
+	api.HandleFunc("/service/{serviceName}/maintenance", ctrl.handlePutServiceNameMaintenance).Methods(http.MethodPut)
+	api.HandleFunc("/watch", ctrl.handleGetWatch).Methods(http.MethodGet)
+	api.HandleFunc("/admin/dead_letters", ctrl.handleGetAdminDeadLetters).Methods(http.MethodGet)
+	api.PathPrefix(cluster.PathPrefix).Handler(cl.Handler())
+	api.Use(ctrl.authMiddleware, ctrl.clusterMiddleware)
 
 	ctrl.serv.Handler = router
 	return &ctrl
@@ -109,7 +139,7 @@ func (ctrl *httpController) handleDeleteNodeId(w http.ResponseWriter, req *http.
 			Error().
 			Err(fmt.Errorf("deregistering in usecase: %w", err)).
 			Send()
-		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+		ctrl.respondWithUsecaseErr(w, err)
 		return
 	}
 
@@ -131,17 +161,28 @@ func (ctrl *httpController) handlePostNode(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	node, err := ctrl.uc.Register(req.Context(), model.RegisterNodeRequest(regNode))
+	mRegNode, err := regNode.ToModel()
+	if err != nil {
+		err = fmt.Errorf("converting request: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	node, err := ctrl.uc.Register(req.Context(), mRegNode)
 	if err != nil {
 		ctrl.logger.
 			Error().
 			Err(fmt.Errorf("registering in usecase: %w", err)).
 			Send()
-		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+		ctrl.respondWithUsecaseErr(w, err)
 		return
 	}
 
-	_ = http_helpers.RespondOK(w, dto.NewNode(node))
+	_ = http_helpers.RespondOK(w, dto.NewRegisterNodeResponse(node))
 }
 
 func (ctrl *httpController) handleGetNode(w http.ResponseWriter, req *http.Request) {
@@ -162,17 +203,182 @@ func (ctrl *httpController) handleGetNodeServiceName(w http.ResponseWriter, req
 	ctrl.getNodes(serviceName, w, req)
 }
 
+// getNodes responds with nodes of the service and their revision in index header.
+// Nodes are filtered by selector and state query params, if set.
+// Nodes of remote datacenter, or of all of them, are requested with dc query param.
+// If index query param is set, response is blocked until revision gets greater
+// than index, or wait query param (30s by default) passes.
 func (ctrl *httpController) getNodes(serviceName string, w http.ResponseWriter, req *http.Request) {
-	nodes, err := ctrl.uc.GetAll(req.Context(), serviceName)
+	index, wait, err := parseBlockingQuery(req)
+	if err != nil {
+		err = fmt.Errorf("parsing blocking query: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sel, err := parseSelector(req)
+	if err != nil {
+		err = fmt.Errorf("parsing selector: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dc := req.URL.Query().Get("dc")
+
+	if index > 0 {
+		if err := ctrl.uc.WaitRevisionIn(req.Context(), dc, serviceName, index, wait); err != nil {
+			if req.Context().Err() != nil {
+				// Client has gone away.
+				return
+			}
+			ctrl.logger.
+				Error().
+				Err(fmt.Errorf("waiting for revision in usecase: %w", err)).
+				Send()
+			ctrl.respondWithUsecaseErr(w, err)
+			return
+		}
+	}
+
+	nodes, rev, err := ctrl.uc.GetAllIn(req.Context(), dc, serviceName, sel)
 	if err != nil {
 		ctrl.logger.
 			Error().
 			Err(fmt.Errorf("getting from usecase: %w", err)).
 			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	dtoNodes := lo.Map(
+		nodes,
+		func(el model.Node, _ int) dto.Node {
+			return dto.NewNode(el)
+		},
+	)
+
+	w.Header().Set(indexHeader, strconv.FormatUint(rev, 10))
+	_ = http_helpers.RespondOK(w, dtoNodes)
+}
+
+func (ctrl *httpController) handleGetAdminDeadLetters(w http.ResponseWriter, req *http.Request) {
+	ds, err := ctrl.uc.DeadLetters(req.Context())
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("getting dead letters from usecase: %w", err)).
+			Send()
 		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
 		return
 	}
 
+	_ = http_helpers.RespondOK(w, lo.Map(
+		ds,
+		func(el model.Delivery, _ int) dto.Delivery {
+			return dto.NewDelivery(el)
+		},
+	))
+}
+
+func (ctrl *httpController) handlePutNodeIdMaintenance(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	nodeID, found := mux.Vars(req)["nodeID"]
+	if !found {
+		err := errors.New("missing nodeID")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	mReq, ok := ctrl.decodeMaintenanceRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var (
+		node model.Node
+		err  error
+	)
+	if mReq.Enable {
+		node, err = ctrl.uc.EnterMaintenance(
+			req.Context(),
+			nodeID,
+			mReq.Reason,
+			time.Duration(mReq.DurationMSec)*time.Millisecond,
+		)
+	} else {
+		node, err = ctrl.uc.ExitMaintenance(req.Context(), nodeID)
+	}
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("setting maintenance in usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, dto.NewNode(node))
+}
+
+func (ctrl *httpController) handlePutServiceNameMaintenance(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	serviceName, found := mux.Vars(req)["serviceName"]
+	if !found {
+		err := errors.New("missing serviceName")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	mReq, ok := ctrl.decodeMaintenanceRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var (
+		nodes []model.Node
+		err   error
+	)
+	if mReq.Enable {
+		nodes, err = ctrl.uc.EnterServiceMaintenance(
+			req.Context(),
+			serviceName,
+			mReq.Reason,
+			time.Duration(mReq.DurationMSec)*time.Millisecond,
+		)
+	} else {
+		nodes, err = ctrl.uc.ExitServiceMaintenance(req.Context(), serviceName)
+	}
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("setting maintenance in usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
 	dtoNodes := lo.Map(
 		nodes,
 		func(el model.Node, _ int) dto.Node {
@@ -182,3 +388,103 @@ func (ctrl *httpController) getNodes(serviceName string, w http.ResponseWriter,
 
 	_ = http_helpers.RespondOK(w, dtoNodes)
 }
+
+func (ctrl *httpController) handlePutNodeIdHeartbeat(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	nodeID, found := mux.Vars(req)["nodeID"]
+	if !found {
+		err := errors.New("missing nodeID")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hbReq := dto.HeartbeatRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&hbReq); err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("decoding body json: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	status := model.CheckStatusPassing
+	if hbReq.Status != "" {
+		var err error
+		status, err = model.ParseCheckStatus(hbReq.Status)
+		if err != nil {
+			err = fmt.Errorf("parsing status: %w", err)
+			ctrl.logger.
+				Error().
+				Err(err).
+				Send()
+			_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if _, err := ctrl.uc.Heartbeat(req.Context(), nodeID, status, hbReq.Note); err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("sending heartbeat to usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, nil)
+}
+
+func (ctrl *httpController) decodeMaintenanceRequest(w http.ResponseWriter, req *http.Request) (dto.MaintenanceRequest, bool) {
+	mReq := dto.MaintenanceRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&mReq); err != nil {
+		err = fmt.Errorf("decoding body json: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return dto.MaintenanceRequest{}, false
+	}
+
+	if mReq.DurationMSec < 0 {
+		err := fmt.Errorf("duration must be non-negative, got: %d", mReq.DurationMSec)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return dto.MaintenanceRequest{}, false
+	}
+
+	return mReq, true
+}
+
+func (ctrl *httpController) respondWithUsecaseErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, nodes.ErrNotFound):
+		_ = http_helpers.RespondWithErr(w, http.StatusNotFound, nodes.ErrNotFound)
+	case errors.Is(err, model.ErrInvalidStateTransition):
+		_ = http_helpers.RespondWithErr(w, http.StatusConflict, err)
+	case errors.Is(err, model.ErrInvalidRequest):
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+	case errors.Is(err, model.ErrSecretMismatch):
+		_ = http_helpers.RespondWithErr(w, http.StatusForbidden, model.ErrSecretMismatch)
+	case errors.Is(err, cluster.ErrNotLeader):
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, cluster.ErrNotLeader)
+	case errors.Is(err, remote_nodes.ErrUnknownDatacenter):
+		_ = http_helpers.RespondWithErr(w, http.StatusNotFound, remote_nodes.ErrUnknownDatacenter)
+	case errors.Is(err, remote_nodes.ErrNotSynced):
+		_ = http_helpers.RespondWithErr(w, http.StatusServiceUnavailable, remote_nodes.ErrNotSynced)
+	default:
+		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+	}
+}
@@ -0,0 +1,263 @@
+package http_controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-resty/resty/v2"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKey = "test_key"
+
+type noUpds struct{}
+
+func (noUpds) Out() <-chan model.Node { return nil }
+
+type noGw struct{}
+
+func (noGw) Send(context.Context, model.Event, []model.Node) error { return nil }
+
+// newTestServer serves controller over usecase with in-memory repo.
+// Client has api key set.
+func newTestServer(t *testing.T, metricsProtected bool) (*discovery.Usecase, *resty.Client) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	uc := discovery.New(nodesRepo, nil, nil, noUpds{}, noGw{}, "dc1", 0, zerolog.Nop())
+
+	return uc, serve(t, uc, metricsProtected)
+}
+
+// serve serves controller over usecase. Client has api key set.
+func serve(t *testing.T, uc *discovery.Usecase, metricsProtected bool) *resty.Client {
+	ctrl := New("", uc, cluster.Standalone{}, testAPIKey, metricsProtected, zerolog.Nop())
+
+	serv := httptest.NewServer(ctrl.serv.Handler)
+	t.Cleanup(serv.Close)
+
+	return resty.New().
+		SetBaseURL(serv.URL).
+		SetHeader("X-Api-Key", testAPIKey)
+}
+
+func register(t *testing.T, cl *resty.Client, req dto.RegisterNodeRequest) dto.RegisterNodeResponse {
+	res := dto.RegisterNodeResponse{}
+	resp, err := cl.R().
+		SetBody(req).
+		SetResult(&res).
+		ForceContentType("application/json").
+		Post("/node")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+
+	return res
+}
+
+func TestServiceNodeStates(t *testing.T) {
+	uc, cl := newTestServer(t, false)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() { _ = uc.StartMaintenance(ctx) }()
+
+	n := register(t, cl, dto.RegisterNodeRequest{
+		Hostname:    "host1:8080",
+		ServiceName: "foo",
+		Check:       &dto.Check{Kind: model.CheckKindTtl.String(), TTLMSec: 60_000},
+	})
+
+	resp, err := cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true, Reason: "upgrade"}).
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+
+	// Drain is finished without revision bump, yet service nodes show it.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		details := dto.ServiceDetails{}
+		resp, err := cl.R().
+			SetResult(&details).
+			ForceContentType("application/json").
+			Get("/service/foo")
+		require.NoError(c, err)
+		require.Equal(c, http.StatusOK, resp.StatusCode())
+		require.Len(c, details.Nodes, 1)
+		assert.Equal(c, model.StateMaintenance.String(), details.Nodes[0].State)
+	}, time.Second*3, time.Millisecond*50)
+}
+
+func TestNodeMaintenance(t *testing.T) {
+	_, cl := newTestServer(t, false)
+
+	n := register(t, cl, dto.RegisterNodeRequest{
+		Hostname:    "host1:8080",
+		ServiceName: "foo",
+		Check:       &dto.Check{Kind: model.CheckKindTtl.String(), TTLMSec: 60_000},
+	})
+
+	node := dto.Node{}
+	resp, err := cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true, Reason: "upgrade", DurationMSec: 60_000}).
+		SetResult(&node).
+		ForceContentType("application/json").
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	assert.Equal(t, model.StateDraining.String(), node.State)
+	require.NotNil(t, node.Maintenance)
+	assert.Equal(t, "upgrade", node.Maintenance.Reason)
+	require.NotNil(t, node.Maintenance.Until)
+	assert.Equal(t, node.Maintenance.Since.Add(time.Minute), *node.Maintenance.Until)
+
+	node = dto.Node{}
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: false}).
+		SetResult(&node).
+		ForceContentType("application/json").
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	assert.Equal(t, model.StateStarting.String(), node.State)
+	assert.Nil(t, node.Maintenance)
+
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true, DurationMSec: -1}).
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true}).
+		Put("/node/unknown_id/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	resp, err = cl.R().Delete("/node/" + n.ID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true}).
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode())
+
+	resp, err = cl.R().
+		SetHeader("X-Api-Key", "wrong_key").
+		SetBody(dto.MaintenanceRequest{Enable: true}).
+		Put("/node/" + n.ID + "/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+}
+
+func TestServiceMaintenance(t *testing.T) {
+	_, cl := newTestServer(t, false)
+
+	for _, req := range []dto.RegisterNodeRequest{
+		{Hostname: "host1:8080", ServiceName: "foo"},
+		{Hostname: "host2:8080", ServiceName: "foo"},
+		{Hostname: "host3:8080", ServiceName: "bar"},
+	} {
+		req.Check = &dto.Check{Kind: model.CheckKindTtl.String(), TTLMSec: 60_000}
+		register(t, cl, req)
+	}
+
+	nodes := []dto.Node{}
+	resp, err := cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true, Reason: "migration"}).
+		SetResult(&nodes).
+		ForceContentType("application/json").
+		Put("/service/foo/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	require.Len(t, nodes, 2)
+	for _, n := range nodes {
+		assert.Equal(t, "foo", n.ServiceName)
+		assert.Equal(t, model.StateDraining.String(), n.State)
+		require.NotNil(t, n.Maintenance)
+		assert.Equal(t, "migration", n.Maintenance.Reason)
+		assert.Nil(t, n.Maintenance.Until)
+	}
+
+	// Nodes of other services are not affected.
+	details := dto.ServiceDetails{}
+	resp, err = cl.R().
+		SetResult(&details).
+		ForceContentType("application/json").
+		Get("/service/bar")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	require.Len(t, details.Nodes, 1)
+	assert.Equal(t, model.StateStarting.String(), details.Nodes[0].State)
+
+	nodes = []dto.Node{}
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: false}).
+		SetResult(&nodes).
+		ForceContentType("application/json").
+		Put("/service/foo/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	require.Len(t, nodes, 2)
+	for _, n := range nodes {
+		assert.Equal(t, model.StateStarting.String(), n.State)
+		assert.Nil(t, n.Maintenance)
+	}
+
+	// Service without nodes has nothing to process.
+	nodes = nil
+	resp, err = cl.R().
+		SetBody(dto.MaintenanceRequest{Enable: true}).
+		SetResult(&nodes).
+		ForceContentType("application/json").
+		Put("/service/unknown/maintenance")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+	assert.Empty(t, nodes)
+
+	resp, err = cl.R().
+		SetBody(`{"Enable": `).
+		Put("/service/foo/maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestRegisterRequiresSecret(t *testing.T) {
+	_, cl := newTestServer(t, false)
+
+	req := dto.RegisterNodeRequest{
+		Hostname:    "host1:8080",
+		ServiceName: "foo",
+		Check:       &dto.Check{Kind: model.CheckKindTtl.String(), TTLMSec: 60_000},
+	}
+	n := register(t, cl, req)
+
+	// Live node can't be taken over with api key only.
+	req.UpdEndpoint = "http://attacker:8080/upd"
+	resp, err := cl.R().
+		SetBody(req).
+		Post("/node")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	req.Secret = n.Secret
+	again := register(t, cl, req)
+	assert.Equal(t, n.ID, again.ID)
+	assert.Equal(t, n.Secret, again.Secret)
+}
@@ -0,0 +1,76 @@
+package dto
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Check struct {
+	Kind             string
+	IntervalMSec     int               `json:",omitempty"`
+	TimeoutMSec      int               `json:",omitempty"`
+	Retries          int               `json:",omitempty"`
+	TTLMSec          int               `json:",omitempty"`
+	Address          string            `json:",omitempty"`
+	GRPCService      string            `json:",omitempty"`
+	GRPCUseTLS       bool              `json:",omitempty"`
+	ExpectedStatuses []int             `json:",omitempty"`
+	BodyMatch        string            `json:",omitempty"`
+	Method           string            `json:",omitempty"`
+	Headers          map[string]string `json:",omitempty"`
+	TLSSkipVerify    bool              `json:",omitempty"`
+	Command          []string          `json:",omitempty"`
+}
+
+func (c *Check) ToModel() (model.Check, error) {
+	if c == nil {
+		return model.Check{Kind: model.CheckKindHttp}, nil
+	}
+
+	kind, err := model.ParseCheckKind(c.Kind)
+	if err != nil {
+		return model.Check{}, fmt.Errorf("parsing check kind: %w", err)
+	}
+
+	return model.Check{
+		Kind:             kind,
+		Interval:         time.Duration(c.IntervalMSec) * time.Millisecond,
+		Timeout:          time.Duration(c.TimeoutMSec) * time.Millisecond,
+		Retries:          c.Retries,
+		TTL:              time.Duration(c.TTLMSec) * time.Millisecond,
+		Address:          c.Address,
+		GRPCService:      c.GRPCService,
+		GRPCUseTLS:       c.GRPCUseTLS,
+		ExpectedStatuses: c.ExpectedStatuses,
+		BodyMatch:        c.BodyMatch,
+		Method:           c.Method,
+		Headers:          c.Headers,
+		TLSSkipVerify:    c.TLSSkipVerify,
+		Command:          c.Command,
+	}, nil
+}
+
+type HeartbeatRequest struct {
+	Status string
+	Note   string
+}
+
+type Heartbeat struct {
+	At     time.Time
+	Status string
+	Note   string `json:",omitempty"`
+}
+
+func NewHeartbeat(hb *model.Heartbeat) *Heartbeat {
+	if hb == nil {
+		return nil
+	}
+
+	return &Heartbeat{
+		At:     hb.At,
+		Status: hb.Status.String(),
+		Note:   hb.Note,
+	}
+}
@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Delivery struct {
+	Seq        uint64
+	ReceiverID string
+	Endpoint   string
+	Kind       string
+	Upd        Node
+	CreatedAt  time.Time
+	Attempts   int
+	LastError  string
+}
+
+func NewDelivery(d model.Delivery) Delivery {
+	return Delivery{
+		Seq:        d.Seq,
+		ReceiverID: d.ReceiverID,
+		Endpoint:   d.Endpoint,
+		Kind:       d.Kind.String(),
+		Upd:        NewNode(d.Upd),
+		CreatedAt:  d.CreatedAt,
+		Attempts:   d.Attempts,
+		LastError:  d.LastError,
+	}
+}
@@ -0,0 +1,35 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type MaintenanceRequest struct {
+	Enable       bool
+	Reason       string
+	DurationMSec int
+}
+
+type Maintenance struct {
+	Reason string
+	Since  time.Time
+	Until  *time.Time `json:",omitempty"`
+}
+
+func NewMaintenance(m *model.Maintenance) *Maintenance {
+	if m == nil {
+		return nil
+	}
+
+	res := Maintenance{
+		Reason: m.Reason,
+		Since:  m.Since,
+	}
+	if !m.Until.IsZero() {
+		res.Until = &m.Until
+	}
+
+	return &res
+}
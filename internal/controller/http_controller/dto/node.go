@@ -1,13 +1,26 @@
 package dto
 
-import "github.com/horockey/service_discovery/internal/model"
+import (
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
 
 type Node struct {
+	// Event is kind of the change in node updates: updated, removed or meta-changed.
+	// It is empty in node lists.
+	Event       string `json:",omitempty"`
 	ID          string
 	Hostname    string
 	ServiceName string
 	State       string
+	Damped      bool
 	Meta        map[string]string
+	Maintenance *Maintenance `json:",omitempty"`
+	Heartbeat   *Heartbeat   `json:",omitempty"`
+	Datacenter  string       `json:",omitempty"`
+	Revision    uint64
+	ChangedAt   time.Time
 }
 
 func NewNode(n model.Node) Node {
@@ -16,6 +29,12 @@ func NewNode(n model.Node) Node {
 		Hostname:    n.Hostname,
 		ServiceName: n.ServiceName,
 		State:       n.State.String(),
+		Damped:      n.Damped,
 		Meta:        n.Meta,
+		Maintenance: NewMaintenance(n.Maintenance),
+		Heartbeat:   NewHeartbeat(n.Heartbeat),
+		Datacenter:  n.Datacenter,
+		Revision:    n.Revision,
+		ChangedAt:   n.ChangedAt,
 	}
 }
@@ -1,9 +1,51 @@
 package dto
 
+import (
+	"fmt"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
 type RegisterNodeRequest struct {
+	// ID is optional. Node of the service on the same host is updated if it is empty.
+	ID             string `json:",omitempty"`
 	Hostname       string
 	ServiceName    string
 	HealthEndpoint string
 	UpdEndpoint    string
 	Meta           map[string]string
+	Check          *Check `json:",omitempty"`
+	// Secret of the registered node is required to update it while it is alive.
+	Secret string `json:",omitempty"`
+}
+
+func (req RegisterNodeRequest) ToModel() (model.RegisterNodeRequest, error) {
+	check, err := req.Check.ToModel()
+	if err != nil {
+		return model.RegisterNodeRequest{}, fmt.Errorf("converting check: %w", err)
+	}
+
+	return model.RegisterNodeRequest{
+		ID:             req.ID,
+		Hostname:       req.Hostname,
+		ServiceName:    req.ServiceName,
+		HealthEndpoint: req.HealthEndpoint,
+		UpdEndpoint:    req.UpdEndpoint,
+		Meta:           req.Meta,
+		Check:          check,
+		Secret:         req.Secret,
+	}, nil
+}
+
+// RegisterNodeResponse is the only place node secret is exposed.
+type RegisterNodeResponse struct {
+	Node
+	Secret string
+}
+
+func NewRegisterNodeResponse(n model.Node) RegisterNodeResponse {
+	return RegisterNodeResponse{
+		Node:   NewNode(n),
+		Secret: n.Secret,
+	}
 }
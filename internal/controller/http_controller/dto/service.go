@@ -0,0 +1,34 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Service struct {
+	Name       string
+	Total      int
+	Up         int
+	Down       int
+	FirstSeen  time.Time
+	LastChange time.Time
+	MetaKeys   []string
+}
+
+func NewService(s model.Service) Service {
+	return Service{
+		Name:       s.Name,
+		Total:      s.Total,
+		Up:         s.Up,
+		Down:       s.Down,
+		FirstSeen:  s.FirstSeen,
+		LastChange: s.LastChange,
+		MetaKeys:   s.MetaKeys,
+	}
+}
+
+type ServiceDetails struct {
+	Service
+	Nodes []Node
+}
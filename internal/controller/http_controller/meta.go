@@ -0,0 +1,94 @@
+package http_controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+)
+
+// handlePatchNodeIdMeta merges body into node meta. Keys with null values are deleted.
+func (ctrl *httpController) handlePatchNodeIdMeta(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	nodeID, found := mux.Vars(req)["nodeID"]
+	if !found {
+		err := errors.New("missing nodeID")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	patch := map[string]*string{}
+	if err := json.NewDecoder(req.Body).Decode(&patch); err != nil {
+		err = fmt.Errorf("decoding body json: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	node, err := ctrl.uc.PatchMeta(req.Context(), nodeID, patch)
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("patching meta in usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, dto.NewNode(node))
+}
+
+// handlePutNodeIdMeta replaces node meta with body.
+func (ctrl *httpController) handlePutNodeIdMeta(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	nodeID, found := mux.Vars(req)["nodeID"]
+	if !found {
+		err := errors.New("missing nodeID")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	meta := map[string]string{}
+	if err := json.NewDecoder(req.Body).Decode(&meta); err != nil {
+		err = fmt.Errorf("decoding body json: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	node, err := ctrl.uc.ReplaceMeta(req.Context(), nodeID, meta)
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("replacing meta in usecase: %w", err)).
+			Send()
+		ctrl.respondWithUsecaseErr(w, err)
+		return
+	}
+
+	_ = http_helpers.RespondOK(w, dto.NewNode(node))
+}
@@ -0,0 +1,61 @@
+package http_controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/horockey/service_discovery/internal/metrics"
+)
+
+const metricsPath = "/metrics"
+
+// statusRecorder remembers response status code.
+// It keeps http.Flusher of the wrapped writer available for watch streams.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.code = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// metricsMiddleware counts requests by route template,
+// so that path params do not blow up label cardinality.
+func (ctrl *httpController) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		startedAt := time.Now()
+		next.ServeHTTP(rec, req)
+
+		route := routeTemplate(req)
+		metrics.HTTPRequests.
+			WithLabelValues(req.Method, route, strconv.Itoa(rec.code)).
+			Inc()
+		metrics.HTTPRequestDuration.
+			WithLabelValues(req.Method, route).
+			Observe(time.Since(startedAt).Seconds())
+	})
+}
+
+func routeTemplate(req *http.Request) string {
+	if r := mux.CurrentRoute(req); r != nil {
+		if tpl, err := r.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,178 @@
+package http_controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/go-resty/resty/v2"
+	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/extractor/health_upds/http_check_health_upds"
+	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/horockey/service_discovery/internal/usecase/discovery"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns samples exposed on /metrics by series.
+func scrape(t require.TestingT, cl *resty.Client) map[string]float64 {
+	resp, err := cl.R().Get(metricsPath)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode(), resp.String())
+
+	res := map[string]float64{}
+	sc := bufio.NewScanner(strings.NewReader(resp.String()))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.LastIndex(line, " ")
+		val, err := strconv.ParseFloat(line[idx+1:], 64)
+		require.NoError(t, err, line)
+		res[line[:idx]] = val
+	}
+
+	return res
+}
+
+// sum adds up samples of the metric having all given labels.
+func sum(samples map[string]float64, name string, labels ...string) float64 {
+	var res float64
+	for series, val := range samples {
+		if series != name && !strings.HasPrefix(series, name+"{") {
+			continue
+		}
+		matched := true
+		for _, l := range labels {
+			matched = matched && strings.Contains(series, l)
+		}
+		if matched {
+			res += val
+		}
+	}
+
+	return res
+}
+
+func TestMetrics(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*100,
+		1,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		zerolog.Nop(),
+	)
+	require.NoError(t, err)
+
+	gw, err := http_broadcast_nodes_updates.New(
+		1,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Millisecond * 50, Max: time.Millisecond * 100},
+		time.Minute,
+		zerolog.Nop(),
+	)
+	require.NoError(t, err)
+
+	uc := discovery.New(nodesRepo, outboxRepo, nil, ex, gw, "dc1", 0, zerolog.Nop())
+	cl := serve(t, uc, false)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() { _ = ex.Start(ctx) }()
+	go func() { _ = gw.Start(ctx) }()
+	go func() { _ = uc.Start(ctx) }()
+
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer receiver.Close()
+
+	before := scrape(t, cl)
+
+	// Receiver is notified once the checked node fails.
+	register(t, cl, dto.RegisterNodeRequest{
+		Hostname:    "receiver:8080",
+		ServiceName: "metrics_service",
+		UpdEndpoint: receiver.URL + "/upd",
+		Check:       &dto.Check{Kind: model.CheckKindTtl.String(), TTLMSec: 60_000},
+	})
+	register(t, cl, dto.RegisterNodeRequest{
+		Hostname:       "checked:8080",
+		ServiceName:    "metrics_service",
+		HealthEndpoint: unhealthy.URL + "/health",
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		after := scrape(c, cl)
+
+		assert.Equal(c,
+			sum(before, "discovery_http_requests_total", `method="POST"`, `route="/node"`, `code="200"`)+2,
+			sum(after, "discovery_http_requests_total", `method="POST"`, `route="/node"`, `code="200"`),
+		)
+		assert.Equal(c,
+			sum(before, "discovery_state_transitions_total", `service="metrics_service"`, `from="starting"`, `to="critical"`)+1,
+			sum(after, "discovery_state_transitions_total", `service="metrics_service"`, `from="starting"`, `to="critical"`),
+		)
+		assert.Greater(c,
+			sum(after, "discovery_healthcheck_failures_total", `kind="http"`),
+			sum(before, "discovery_healthcheck_failures_total", `kind="http"`),
+		)
+		assert.Greater(c,
+			sum(after, "discovery_healthcheck_duration_seconds_count", `kind="http"`),
+			sum(before, "discovery_healthcheck_duration_seconds_count", `kind="http"`),
+		)
+		assert.Greater(c,
+			sum(after, "discovery_upds_delivery_duration_seconds_count"),
+			sum(before, "discovery_upds_delivery_duration_seconds_count"),
+		)
+	}, time.Second*5, time.Millisecond*100)
+}
+
+func TestMetricsAuth(t *testing.T) {
+	_, open := newTestServer(t, false)
+	resp, err := open.R().
+		SetHeader("X-Api-Key", "").
+		Get(metricsPath)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	_, protected := newTestServer(t, true)
+	for key, code := range map[string]int{
+		"":          http.StatusForbidden,
+		"wrong_key": http.StatusForbidden,
+		testAPIKey:  http.StatusOK,
+	} {
+		resp, err := protected.R().
+			SetHeader("X-Api-Key", key).
+			Get(metricsPath)
+		require.NoError(t, err)
+		assert.Equal(t, code, resp.StatusCode(), key)
+	}
+}
@@ -0,0 +1,23 @@
+package http_controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+func parseSelector(req *http.Request) (model.Selector, error) {
+	query := req.URL.Query()
+
+	sel, err := model.ParseSelector(query.Get("selector"))
+	if err != nil {
+		return model.Selector{}, fmt.Errorf("parsing selector: %w", err)
+	}
+
+	if sel.States, err = model.ParseStates(query.Get("state")); err != nil {
+		return model.Selector{}, fmt.Errorf("parsing state: %w", err)
+	}
+
+	return sel, nil
+}
@@ -0,0 +1,41 @@
+package http_controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/horockey/service_discovery/internal/controller/http_controller")
+
+// tracingMiddleware starts server span for the request,
+// continuing trace of the caller if it is propagated.
+func (ctrl *httpController) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := routeTemplate(req)
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(
+			ctx,
+			req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", route),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.code))
+		if rec.code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("got status %d", rec.code))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package http_controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/horockey/go-toolbox/http_helpers"
+	"github.com/horockey/service_discovery/internal/controller/http_controller/dto"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/samber/lo"
+)
+
+const (
+	snapshotEvent = "snapshot"
+	keepAliveIvl  = time.Second * 15
+)
+
+// handleGetWatch streams changes of the service nodes as server-sent events.
+// Stream starts with snapshot of the service nodes, unless watcher resumes
+// from revision passed in since query param or Last-Event-ID header
+// and following events are still kept by discovery.
+func (ctrl *httpController) handleGetWatch(w http.ResponseWriter, req *http.Request) {
+	serviceName := req.URL.Query().Get("service")
+	if serviceName == "" {
+		err := errors.New("missing service")
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	since, err := parseSince(req)
+	if err != nil {
+		err = fmt.Errorf("parsing since: %w", err)
+		ctrl.logger.
+			Error().
+			Err(err).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ctrl.logger.
+			Error().
+			Err(errors.New("streaming is not supported by response writer")).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	watch, err := ctrl.uc.Watch(req.Context(), serviceName, since)
+	if err != nil {
+		ctrl.logger.
+			Error().
+			Err(fmt.Errorf("watching in usecase: %w", err)).
+			Send()
+		_ = http_helpers.RespondWithErr(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !watch.Resumed {
+		snapshot := lo.Map(
+			watch.Snapshot,
+			func(el model.Node, _ int) dto.Node {
+				return dto.NewNode(el)
+			},
+		)
+		if err := writeEvent(w, watch.Revision, snapshotEvent, snapshot); err != nil {
+			ctrl.logger.Error().Err(err).Send()
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case ev, ok := <-watch.Events:
+			if !ok {
+				// Watcher is not keeping up and is expected to resume.
+				return
+			}
+			if ev.Node.Revision <= watch.Revision {
+				continue
+			}
+
+			if err := writeEvent(w, ev.Node.Revision, ev.Kind.String(), dto.NewNode(ev.Node)); err != nil {
+				ctrl.logger.Error().Err(err).Send()
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func parseSince(req *http.Request) (uint64, error) {
+	s := req.URL.Query().Get("since")
+	if s == "" {
+		s = req.Header.Get("Last-Event-ID")
+	}
+	if s == "" {
+		return 0, nil
+	}
+
+	since, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing uint: %w", err)
+	}
+
+	return since, nil
+}
+
+func writeEvent(w http.ResponseWriter, id uint64, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload); err != nil {
+		return fmt.Errorf("writing event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package cluster_health_upds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/extractor/health_upds"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/tracing"
+	"github.com/rs/zerolog"
+)
+
+var _ health_upds.Extractor = &clusterHealthUpds{}
+
+const forwardTimeout = time.Second * 3
+
+type clusterHealthUpds struct {
+	local   health_upds.Extractor
+	cluster cluster.Cluster
+	out     chan model.Node
+	logger  zerolog.Logger
+}
+
+// New creates extractor emitting updates of nodes checked by all replicas
+// on the leader, and nothing on other replicas, which send updates
+// of the local extractor to the leader instead.
+func New(
+	local health_upds.Extractor,
+	cl cluster.Cluster,
+	outChSize int,
+	logger zerolog.Logger,
+) (*clusterHealthUpds, error) {
+	if outChSize <= 0 {
+		return nil, fmt.Errorf("channel size num must be positive, got: %d", outChSize)
+	}
+
+	return &clusterHealthUpds{
+		local:   local,
+		cluster: cl,
+		out:     make(chan model.Node, outChSize),
+		logger:  logger,
+	}, nil
+}
+
+func (ex *clusterHealthUpds) Start(ctx context.Context) error {
+	defer close(ex.out)
+
+	localOut := ex.local.Out()
+	for {
+		var upd model.Node
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("running context: %w", ctx.Err())
+
+		case upd = <-ex.cluster.ForwardedUpds():
+
+		case localUpd, ok := <-localOut:
+			if !ok {
+				localOut = nil
+				continue
+			}
+			if !ex.cluster.IsLeader() {
+				ex.forward(ctx, localUpd)
+				continue
+			}
+			upd = localUpd
+		}
+
+		select {
+		case ex.out <- upd:
+		case <-ctx.Done():
+			return fmt.Errorf("running context: %w", ctx.Err())
+		}
+	}
+}
+
+func (ex *clusterHealthUpds) Out() <-chan model.Node {
+	return ex.out
+}
+
+// forward sends update to the leader. Lost update is not retried,
+// as it is emitted again on the next check while stored state differs.
+func (ex *clusterHealthUpds) forward(ctx context.Context, upd model.Node) {
+	ctx, cancel := context.WithTimeout(tracing.Extract(ctx, upd.Trace), forwardTimeout)
+	defer cancel()
+
+	if err := ex.cluster.ForwardUpd(ctx, upd); err != nil {
+		ex.logger.
+			Warn().
+			Str("node_id", upd.ID).
+			Err(fmt.Errorf("forwarding upd to leader: %w", err)).
+			Send()
+	}
+}
@@ -0,0 +1,20 @@
+package http_check_health_upds
+
+import (
+	"context"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+// checker performs single health check of the given kind.
+// errNoResult is returned if node health can not be judged yet.
+type checker interface {
+	check(ctx context.Context, node model.Node) (model.CheckStatus, error)
+}
+
+func checkAddress(node model.Node) string {
+	if node.Check.Address != "" {
+		return node.Check.Address
+	}
+	return node.Hostname
+}
@@ -0,0 +1,55 @@
+package http_check_health_upds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+const execOutputLimit = 256
+
+// execChecker runs only the commands from allowed list, arguments included,
+// as nodes register themselves and can not be trusted.
+type execChecker struct {
+	allowed [][]string
+}
+
+func (ch execChecker) check(ctx context.Context, node model.Node) (model.CheckStatus, error) {
+	allowed := slices.ContainsFunc(ch.allowed, func(el []string) bool {
+		return slices.Equal(el, node.Check.Command)
+	})
+	if !allowed {
+		return model.CheckStatusCritical, fmt.Errorf("command %q is not allowed", node.Check.Command)
+	}
+
+	// Environment of discovery is not passed, as it holds its secrets.
+	cmd := exec.CommandContext(ctx, node.Check.Command[0], node.Check.Command[1:]...)
+	cmd.Env = []string{
+		"SD_NODE_ID=" + node.ID,
+		"SD_NODE_HOSTNAME=" + node.Hostname,
+		"SD_SERVICE_NAME=" + node.ServiceName,
+	}
+
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if len(output) > execOutputLimit {
+		output = output[:execOutputLimit]
+	}
+
+	exitErr := &exec.ExitError{}
+	switch {
+	case err == nil:
+		return model.CheckStatusPassing, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return model.CheckStatusWarning, nil
+	case errors.As(err, &exitErr):
+		return model.CheckStatusCritical, fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), output)
+	default:
+		return model.CheckStatusCritical, fmt.Errorf("running command: %w", err)
+	}
+}
@@ -0,0 +1,46 @@
+package http_check_health_upds
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+type grpcChecker struct{}
+
+func (grpcChecker) check(ctx context.Context, node model.Node) (model.CheckStatus, error) {
+	creds := insecure.NewCredentials()
+	if node.Check.GRPCUseTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	conn, err := grpc.NewClient(checkAddress(node), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return model.CheckStatusCritical, fmt.Errorf("creating grpc client: %w", err)
+	}
+	defer conn.Close()
+
+	for k, v := range tracing.Inject(ctx) {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{
+		Service: node.Check.GRPCService,
+	})
+	if err != nil {
+		return model.CheckStatusCritical, fmt.Errorf("calling health check: %w", err)
+	}
+	if resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return model.CheckStatusCritical, fmt.Errorf("got non-serving status: %s", resp.GetStatus())
+	}
+
+	return model.CheckStatusPassing, nil
+}
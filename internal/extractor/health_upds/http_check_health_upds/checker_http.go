@@ -0,0 +1,88 @@
+package http_check_health_upds
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/signature"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+type httpChecker struct {
+	cl         *resty.Client
+	insecureCl *resty.Client
+}
+
+func newHTTPChecker() httpChecker {
+	return httpChecker{
+		cl: resty.New().
+			SetLogger(emptyRestyLogger{}),
+		insecureCl: resty.New().
+			SetLogger(emptyRestyLogger{}).
+			SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true}),
+	}
+}
+
+func (ch httpChecker) check(ctx context.Context, node model.Node) (model.CheckStatus, error) {
+	cl := ch.cl
+	if node.Check.TLSSkipVerify {
+		cl = ch.insecureCl
+	}
+
+	method := node.Check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req := cl.R().
+		SetContext(ctx).
+		SetHeaders(node.Check.Headers)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// Nodes registered before per-node secrets were introduced have none.
+	if node.Secret != "" {
+		u, err := url.Parse(node.HealthEndpoint)
+		if err != nil {
+			return model.CheckStatusCritical, fmt.Errorf("parsing health endpoint: %w", err)
+		}
+		headers, err := signature.Headers(node.Secret, method, u.Path, nil, time.Now())
+		if err != nil {
+			return model.CheckStatusCritical, fmt.Errorf("signing request: %w", err)
+		}
+		req.SetHeaders(headers)
+	}
+
+	resp, err := req.Execute(method, node.HealthEndpoint)
+	if err != nil {
+		return model.CheckStatusCritical, fmt.Errorf("executing request: %w", err)
+	}
+
+	expected := node.Check.ExpectedStatuses
+	if len(expected) == 0 {
+		expected = []int{http.StatusOK}
+	}
+	if !slices.Contains(expected, resp.StatusCode()) {
+		return model.CheckStatusCritical, fmt.Errorf("got unexpected response (%s): %s", resp.Status(), resp.String())
+	}
+
+	if node.Check.BodyMatch != "" {
+		re, err := regexp.Compile(node.Check.BodyMatch)
+		if err != nil {
+			return model.CheckStatusCritical, fmt.Errorf("compiling body match regexp: %w", err)
+		}
+		if !re.Match(resp.Body()) {
+			return model.CheckStatusCritical, fmt.Errorf("response body does not match %q: %s", node.Check.BodyMatch, resp.String())
+		}
+	}
+
+	return model.CheckStatusPassing, nil
+}
@@ -0,0 +1,23 @@
+package http_check_health_upds
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type tcpChecker struct{}
+
+func (tcpChecker) check(ctx context.Context, node model.Node) (model.CheckStatus, error) {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", checkAddress(node))
+	if err != nil {
+		return model.CheckStatusCritical, fmt.Errorf("dialing: %w", err)
+	}
+	_ = conn.Close()
+
+	return model.CheckStatusPassing, nil
+}
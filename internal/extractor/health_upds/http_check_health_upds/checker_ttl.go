@@ -0,0 +1,31 @@
+package http_check_health_upds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type ttlChecker struct{}
+
+func (ttlChecker) check(_ context.Context, node model.Node) (model.CheckStatus, error) {
+	now := time.Now()
+
+	if node.Heartbeat == nil {
+		if now.Sub(node.RegisteredAt) <= node.Check.TTL {
+			return model.CheckStatusCritical, errNoResult
+		}
+		return model.CheckStatusCritical, fmt.Errorf("no heartbeat within ttl %s since registration", node.Check.TTL)
+	}
+
+	if now.Sub(node.Heartbeat.At) > node.Check.TTL {
+		return model.CheckStatusCritical, fmt.Errorf("last heartbeat is older than ttl %s", node.Check.TTL)
+	}
+	if node.Heartbeat.Status == model.CheckStatusCritical {
+		return model.CheckStatusCritical, fmt.Errorf("node reported critical status: %s", node.Heartbeat.Note)
+	}
+
+	return node.Heartbeat.Status, nil
+}
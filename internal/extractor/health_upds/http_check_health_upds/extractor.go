@@ -2,34 +2,70 @@ package http_check_health_upds
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"sync"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/horockey/service_discovery/internal/extractor/health_upds"
+	"github.com/horockey/service_discovery/internal/metrics"
 	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/tracing"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ health_upds.Extractor = &httpCheckHealthUpds{}
 
+const (
+	probeTimeout  = time.Second * 3
+	retryWait     = time.Millisecond * 100
+	schedulerTick = time.Millisecond * 100
+)
+
+var errNoResult = errors.New("no check result")
+
+var tracer = otel.Tracer("github.com/horockey/service_discovery/internal/extractor/health_upds/http_check_health_upds")
+
 type httpCheckHealthUpds struct {
-	nodesRepo     ReadOnlyRepo
-	cl            *resty.Client
-	out           chan model.Node
-	checkInterval time.Duration
-	logger        zerolog.Logger
+	nodesRepo         ReadOnlyRepo
+	out               chan model.Node
+	checkInterval     time.Duration
+	workersNum        int
+	thresholds        Thresholds
+	serviceThresholds map[string]Thresholds
+	flap              FlapDamping
+	checkers          map[model.CheckKind]checker
+	logger            zerolog.Logger
+
+	statsMu sync.Mutex
+	stats   map[string]*nodeStats
+
+	sched *schedule
+	// scannedRev and scannedAt are the global revision and time of the last nodes listing.
+	// They are only accessed by dispatching goroutine.
+	scannedRev uint64
+	scannedAt  time.Time
 }
+
 type ReadOnlyRepo interface {
 	GetAll(ctx context.Context) ([]model.Node, error)
+	// Revision returns revision of the service, or the global one for empty serviceName.
+	Revision(ctx context.Context, serviceName string) (uint64, error)
 }
 
 func New(
 	nodesRepo ReadOnlyRepo,
 	outChSize int,
 	checkInterval time.Duration,
-	apiKey string,
+	workersNum int,
+	thresholds Thresholds,
+	serviceThresholds map[string]Thresholds,
+	flap FlapDamping,
+	execCommands [][]string,
 	logger zerolog.Logger,
 ) (*httpCheckHealthUpds, error) {
 	if outChSize <= 0 {
@@ -38,39 +74,72 @@ func New(
 	if checkInterval <= 0 {
 		return nil, fmt.Errorf("check interval must be positive, got: %d", checkInterval)
 	}
+	if workersNum <= 0 {
+		return nil, fmt.Errorf("workers num must be positive, got: %d", workersNum)
+	}
+	if err := thresholds.validate(); err != nil {
+		return nil, fmt.Errorf("validating thresholds: %w", err)
+	}
+	for serviceName, th := range serviceThresholds {
+		if err := th.validate(); err != nil {
+			return nil, fmt.Errorf("validating thresholds for service %s: %w", serviceName, err)
+		}
+	}
+	if err := flap.validate(); err != nil {
+		return nil, fmt.Errorf("validating flap damping: %w", err)
+	}
 
 	return &httpCheckHealthUpds{
-		nodesRepo:     nodesRepo,
-		out:           make(chan model.Node, outChSize),
-		checkInterval: checkInterval,
-		logger:        logger,
-		cl: resty.New().
-			SetLogger(emptyRestyLogger{}).
-			SetHeader("X-Api-Key", apiKey).
-			SetRetryCount(5),
+		nodesRepo:         nodesRepo,
+		out:               make(chan model.Node, outChSize),
+		checkInterval:     checkInterval,
+		workersNum:        workersNum,
+		thresholds:        thresholds,
+		serviceThresholds: serviceThresholds,
+		flap:              flap,
+		checkers: map[model.CheckKind]checker{
+			model.CheckKindHttp: newHTTPChecker(),
+			model.CheckKindTtl:  ttlChecker{},
+			model.CheckKindTcp:  tcpChecker{},
+			model.CheckKindGrpc: grpcChecker{},
+			model.CheckKindExec: execChecker{allowed: execCommands},
+		},
+		logger: logger,
+		stats:  map[string]*nodeStats{},
+		sched:  newSchedule(),
 	}, nil
 }
 
 func (ex *httpCheckHealthUpds) Start(ctx context.Context) error {
-	ticker := time.NewTicker(ex.checkInterval)
+	tasks := make(chan model.Node)
+
+	var wg sync.WaitGroup
+	for range ex.workersNum {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range tasks {
+				ex.probe(ctx, node)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(min(schedulerTick, ex.checkInterval))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			close(tasks)
+			wg.Wait()
 			close(ex.out)
 			return fmt.Errorf("running context: %w", ctx.Err())
-		case <-ticker.C:
-			upds, err := ex.getUpds(ctx)
-			if err != nil {
+		case now := <-ticker.C:
+			if err := ex.dispatch(ctx, now, tasks); err != nil {
 				ex.logger.
 					Error().
-					Err(fmt.Errorf("getting updates: %w", err)).
+					Err(fmt.Errorf("dispatching checks: %w", err)).
 					Send()
-				continue
-			}
-			for _, upd := range upds {
-				ex.out <- upd
 			}
 		}
 	}
@@ -80,52 +149,141 @@ func (ex *httpCheckHealthUpds) Out() <-chan model.Node {
 	return ex.out
 }
 
-func (ex *httpCheckHealthUpds) getUpds(ctx context.Context) ([]model.Node, error) {
-	nodes, err := ex.nodesRepo.GetAll(ctx)
+// dispatch hands nodes which are due to be checked over to idle workers.
+// Nodes left due because of all workers being busy are dispatched on the next tick.
+// Nodes are listed only if some of them may be due: on schedule, on revision change
+// (e.g. new node), or once per check interval, as some changes don't bump revision
+// (e.g. return from maintenance or change of cluster members).
+func (ex *httpCheckHealthUpds) dispatch(ctx context.Context, now time.Time, tasks chan<- model.Node) error {
+	// Revision is read before nodes, so that change made in between causes another listing.
+	rev, err := ex.nodesRepo.Revision(ctx, "")
 	if err != nil {
-		return nil, fmt.Errorf("getting nodes from repo: %w", err)
+		return fmt.Errorf("getting revision from repo: %w", err)
+	}
+	if rev == ex.scannedRev && now.Sub(ex.scannedAt) < ex.checkInterval && !ex.sched.anyDue(now) {
+		return nil
 	}
 
-	upds := []model.Node{}
+	nodes, err := ex.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes from repo: %w", err)
+	}
+	ex.scannedRev, ex.scannedAt = rev, now
+	nodes = lo.Filter(
+		nodes,
+		func(el model.Node, _ int) bool {
+			return el.State.Checked()
+		},
+	)
 
-	for _, node := range nodes {
-		callCtx, cancel := context.WithTimeout(ctx, time.Second*3)
-		resp, err := ex.cl.R().
-			SetContext(callCtx).
-			Get(node.HealthEndpoint)
-		cancel()
-		if err != nil {
-			ex.logger.
-				Error().
-				Err(fmt.Errorf("executing request: %w", err)).
-				Send()
-
-			if node.State != model.StateDown {
-				node.State = model.StateDown
-				upds = append(upds, node)
-			}
+	ex.cleanupStats(nodes)
+	due := ex.sched.due(nodes, now)
 
-			continue
+	for _, node := range due {
+		prevAt := ex.sched.start(node.ID, now.Add(ex.interval(node)))
+		select {
+		case tasks <- node:
+		default:
+			ex.sched.finish(node.ID, prevAt)
+			return nil
 		}
-		if resp.StatusCode() != http.StatusOK {
-			ex.logger.
-				Error().
-				Err(fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())).
-				Send()
-
-			if node.State != model.StateDown {
-				node.State = model.StateDown
-				upds = append(upds, node)
-			}
+	}
 
-			continue
+	return nil
+}
+
+// probe checks node health and emits update if node state changed.
+// Probe with all its retries is limited by node check interval,
+// so slow nodes can't delay detection for longer than that.
+func (ex *httpCheckHealthUpds) probe(ctx context.Context, node model.Node) {
+	defer ex.sched.finish(node.ID, time.Time{})
+
+	probeCtx, cancel := context.WithTimeout(ctx, ex.interval(node))
+	defer cancel()
+
+	probeCtx, span := tracer.Start(probeCtx, "healthcheck.probe", trace.WithAttributes(
+		attribute.String("node.id", node.ID),
+		attribute.String("node.service", node.ServiceName),
+		attribute.String("check.kind", node.Check.Kind.String()),
+	))
+
+	startedAt := time.Now()
+	status, err := ex.check(probeCtx, node)
+	span.SetAttributes(attribute.String("check.status", status.String()))
+	tracing.End(span, err)
+	switch {
+	case ctx.Err() != nil:
+		return
+	case errors.Is(err, errNoResult):
+		return
+	}
+
+	kind := node.Check.Kind.String()
+	metrics.CheckDuration.WithLabelValues(kind).Observe(time.Since(startedAt).Seconds())
+	if status == model.CheckStatusCritical {
+		metrics.CheckFailures.WithLabelValues(kind, metrics.CheckFailureReason(err)).Inc()
+	}
+
+	if err != nil {
+		ex.logger.
+			Error().
+			Str("node_id", node.ID).
+			Err(fmt.Errorf("checking node health: %w", err)).
+			Send()
+	}
+
+	upd, changed := ex.evaluate(node, status, time.Now())
+	if !changed {
+		return
+	}
+	upd.Trace = tracing.Inject(probeCtx)
+
+	select {
+	case ex.out <- upd:
+	case <-ctx.Done():
+	}
+}
+
+func (ex *httpCheckHealthUpds) check(ctx context.Context, node model.Node) (model.CheckStatus, error) {
+	ch, found := ex.checkers[node.Check.Kind]
+	if !found {
+		return model.CheckStatusCritical, fmt.Errorf("unknown check kind: %s", node.Check.Kind)
+	}
+
+	var (
+		status model.CheckStatus
+		err    error
+	)
+	for attempt := range node.Check.Retries + 1 {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return status, err
+			case <-time.After(retryWait):
+			}
 		}
 
-		if node.State != model.StateUp {
-			node.State = model.StateUp
-			upds = append(upds, node)
+		callCtx, cancel := context.WithTimeout(ctx, ex.timeout(node))
+		status, err = ch.check(callCtx, node)
+		cancel()
+		if err == nil || errors.Is(err, errNoResult) {
+			return status, err
 		}
 	}
 
-	return upds, nil
+	return status, err
+}
+
+func (ex *httpCheckHealthUpds) interval(node model.Node) time.Duration {
+	if node.Check.Interval > 0 {
+		return node.Check.Interval
+	}
+	return ex.checkInterval
+}
+
+func (ex *httpCheckHealthUpds) timeout(node model.Node) time.Duration {
+	if node.Check.Timeout > 0 {
+		return node.Check.Timeout
+	}
+	return min(probeTimeout, ex.interval(node))
 }
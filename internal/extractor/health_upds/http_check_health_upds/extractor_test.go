@@ -2,9 +2,13 @@ package http_check_health_upds_test
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,8 +20,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-const apiKey = "API_KEY"
-
 var logger = zerolog.New(zerolog.ConsoleWriter{
 	Out:        os.Stdout,
 	TimeFormat: time.RFC3339,
@@ -29,7 +31,11 @@ func TestExtractor(t *testing.T) {
 		nodesRepo,
 		10,
 		time.Second,
-		apiKey,
+		10,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
 		logger,
 	)
 	require.NoError(t, err)
@@ -37,11 +43,11 @@ func TestExtractor(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.TODO())
 
 	var (
-		node1Down = model.Node{
+		node1Starting = model.Node{
 			ID:             "node1_id",
 			Hostname:       "node1",
 			ServiceName:    "fooBarService",
-			State:          model.StateDown,
+			State:          model.StateStarting,
 			HealthEndpoint: "http://localhost:9001/health",
 		}
 		node2Up = model.Node{
@@ -53,13 +59,18 @@ func TestExtractor(t *testing.T) {
 		}
 	)
 
-	node1Up := node1Down
+	node1Up := node1Starting
 	node1Up.State = model.StateUp
 
-	node2Down := node2Up
-	node2Down.State = model.StateDown
+	node2Critical := node2Up
+	node2Critical.State = model.StateCritical
+
+	actualStates := []model.Node{node1Starting, node2Up}
 
-	actualStates := []model.Node{node1Down, node2Up}
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
 
 	nodesRepo.EXPECT().
 		GetAll(ctx).
@@ -104,6 +115,512 @@ func TestExtractor(t *testing.T) {
 	cancel()
 	wg.Wait()
 
-	assert.ElementsMatch(t, upds, []model.Node{node1Up, node2Down})
-	assert.ElementsMatch(t, actualStates, []model.Node{node1Up, node2Down})
+	assert.ElementsMatch(t, upds, []model.Node{node1Up, node2Critical})
+	assert.ElementsMatch(t, actualStates, []model.Node{node1Up, node2Critical})
+}
+
+func TestExtractorSlowNode(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*500,
+		2,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	slowServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 10):
+		}
+	}))
+	defer slowServ.Close()
+
+	fastServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fastServ.Close()
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		Return([]model.Node{
+			{
+				ID:             "slow_id",
+				Hostname:       "slow",
+				State:          model.StateUp,
+				HealthEndpoint: slowServ.URL,
+			},
+			{
+				ID:             "fast_id",
+				Hostname:       "fast",
+				State:          model.StateStarting,
+				HealthEndpoint: fastServ.URL,
+			},
+		}, nil)
+
+	go func() { _ = ex.Start(ctx) }()
+
+	upds := map[string]model.State{}
+	timeout := time.After(time.Millisecond * 1500)
+	for len(upds) < 2 {
+		select {
+		case upd := <-ex.Out():
+			upds[upd.ID] = upd.State
+		case <-timeout:
+			require.FailNow(t, "updates were not received in time", "got: %v", upds)
+		}
+	}
+
+	assert.Equal(t, map[string]model.State{
+		"slow_id": model.StateCritical,
+		"fast_id": model.StateUp,
+	}, upds)
+}
+
+func TestExtractorThresholds(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*100,
+		1,
+		http_check_health_upds.Thresholds{Fail: 3, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var hits atomic.Int64
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serv.Close()
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		Return([]model.Node{{
+			ID:             "node_id",
+			State:          model.StateUp,
+			HealthEndpoint: serv.URL,
+		}}, nil)
+
+	go func() { _ = ex.Start(ctx) }()
+
+	states := []model.State{}
+	timeout := time.After(time.Second * 3)
+	for len(states) == 0 || states[len(states)-1] != model.StateCritical {
+		select {
+		case upd := <-ex.Out():
+			states = append(states, upd.State)
+		case <-timeout:
+			require.FailNow(t, "updates were not received in time", "got: %v", states)
+		}
+	}
+
+	assert.Equal(t, model.StateWarning, states[0])
+	assert.GreaterOrEqual(t, hits.Load(), int64(3))
+}
+
+func TestExtractorFlapDamping(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*100,
+		1,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{Window: time.Minute, Threshold: 3},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	var hits atomic.Int64
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer serv.Close()
+
+	var mu sync.Mutex
+	node := model.Node{
+		ID:             "node_id",
+		State:          model.StateUp,
+		HealthEndpoint: serv.URL,
+	}
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		RunAndReturn(func(context.Context) ([]model.Node, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return []model.Node{node}, nil
+		})
+
+	go func() { _ = ex.Start(ctx) }()
+
+	upds := []model.Node{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for upd := range ex.Out() {
+			mu.Lock()
+			node = upd
+			mu.Unlock()
+			upds = append(upds, upd)
+		}
+	}()
+
+	time.Sleep(time.Second)
+	cancel()
+	<-done
+
+	failed := node
+	failed.State = model.StateCritical
+	failed.Damped = false
+
+	upped := failed
+	upped.State = model.StateUp
+
+	damped := upped
+	damped.Damped = true
+
+	assert.Equal(t, []model.Node{failed, upped, damped}, upds)
+}
+
+func TestExtractorTTL(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*100,
+		2,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	now := time.Now()
+	check := model.Check{Kind: model.CheckKindTtl, TTL: time.Minute}
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		Return([]model.Node{
+			{
+				ID:           "fresh_id",
+				State:        model.StateStarting,
+				Check:        check,
+				RegisteredAt: now.Add(-time.Hour),
+				Heartbeat:    &model.Heartbeat{At: now, Status: model.CheckStatusWarning},
+			},
+			{
+				ID:           "stale_id",
+				State:        model.StateUp,
+				Check:        check,
+				RegisteredAt: now.Add(-time.Hour),
+				Heartbeat:    &model.Heartbeat{At: now.Add(-time.Hour), Status: model.CheckStatusPassing},
+			},
+			{
+				ID:           "new_id",
+				State:        model.StateStarting,
+				Check:        check,
+				RegisteredAt: now,
+			},
+		}, nil)
+
+	go func() { _ = ex.Start(ctx) }()
+
+	upds := map[string]model.State{}
+	timeout := time.After(time.Millisecond * 500)
+loop:
+	for {
+		select {
+		case upd := <-ex.Out():
+			upds[upd.ID] = upd.State
+		case <-timeout:
+			break loop
+		}
+	}
+
+	assert.Equal(t, map[string]model.State{
+		"fresh_id": model.StateWarning,
+		"stale_id": model.StateCritical,
+	}, upds)
+}
+
+func TestExtractorCheckKinds(t *testing.T) {
+	truePath, err := exec.LookPath("true")
+	require.NoError(t, err)
+	falsePath, err := exec.LookPath("false")
+	require.NoError(t, err)
+	shPath, err := exec.LookPath("sh")
+	require.NoError(t, err)
+
+	// Command must not see environment of discovery.
+	t.Setenv("DISCOVERY_TEST_SECRET", "secret")
+	envCmd := []string{shPath, "-c", `test -z "$DISCOVERY_TEST_SECRET" && test "$SD_NODE_ID" = exec_env_id`}
+
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Millisecond*500,
+		4,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		[][]string{{truePath}, envCmd},
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer serv.Close()
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		Return([]model.Node{
+			{
+				ID:    "tcp_id",
+				State: model.StateStarting,
+				Check: model.Check{Kind: model.CheckKindTcp, Address: lis.Addr().String()},
+			},
+			{
+				ID:             "http_id",
+				State:          model.StateStarting,
+				HealthEndpoint: serv.URL,
+				Check: model.Check{
+					Kind:             model.CheckKindHttp,
+					ExpectedStatuses: []int{http.StatusOK, http.StatusNoContent},
+				},
+			},
+			{
+				ID:    "exec_id",
+				State: model.StateStarting,
+				Check: model.Check{Kind: model.CheckKindExec, Command: []string{truePath}},
+			},
+			{
+				ID:    "exec_not_allowed_id",
+				State: model.StateUp,
+				Check: model.Check{Kind: model.CheckKindExec, Command: []string{falsePath}},
+			},
+			{
+				ID:    "exec_args_not_allowed_id",
+				State: model.StateUp,
+				Check: model.Check{Kind: model.CheckKindExec, Command: []string{shPath, "-c", truePath}},
+			},
+			{
+				ID:    "exec_env_id",
+				State: model.StateStarting,
+				Check: model.Check{Kind: model.CheckKindExec, Command: envCmd},
+			},
+		}, nil)
+
+	go func() { _ = ex.Start(ctx) }()
+
+	upds := map[string]model.State{}
+	timeout := time.After(time.Second * 2)
+	for len(upds) < 6 {
+		select {
+		case upd := <-ex.Out():
+			upds[upd.ID] = upd.State
+		case <-timeout:
+			require.FailNow(t, "updates were not received in time", "got: %v", upds)
+		}
+	}
+
+	assert.Equal(t, map[string]model.State{
+		"tcp_id":              model.StateUp,
+		"http_id":             model.StateUp,
+		"exec_id":             model.StateUp,
+		"exec_not_allowed_id": model.StateCritical,
+		// Allowed command with arguments of the node's own.
+		"exec_args_not_allowed_id": model.StateCritical,
+		"exec_env_id":              model.StateUp,
+	}, upds)
+}
+
+func TestExtractorNodeCheckConfig(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Second,
+		2,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var fastHits, slowHits atomic.Int64
+	fastServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastHits.Add(1)
+		if r.Method != http.MethodHead || r.Header.Get("X-Probe") != "fast" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fastServ.Close()
+
+	slowServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slowServ.Close()
+
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		Return(0, nil).
+		Maybe()
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		Return([]model.Node{
+			{
+				ID:             "fast_id",
+				State:          model.StateUp,
+				HealthEndpoint: fastServ.URL,
+				Check: model.Check{
+					Kind:     model.CheckKindHttp,
+					Interval: time.Millisecond * 100,
+					Method:   http.MethodHead,
+					Headers:  map[string]string{"X-Probe": "fast"},
+				},
+			},
+			{
+				ID:             "slow_id",
+				State:          model.StateUp,
+				HealthEndpoint: slowServ.URL,
+			},
+		}, nil)
+
+	go func() { _ = ex.Start(ctx) }()
+
+	select {
+	case upd := <-ex.Out():
+		require.FailNow(t, "unexpected update", "got: %v", upd)
+	case <-time.After(time.Millisecond * 1500):
+	}
+
+	assert.GreaterOrEqual(t, fastHits.Load(), int64(8))
+	assert.LessOrEqual(t, slowHits.Load(), int64(2))
+}
+
+func TestExtractorListsOnlyWhenDue(t *testing.T) {
+	nodesRepo := mock_nodes.NewMockReadOnlyRepo(t)
+	ex, err := http_check_health_upds.New(
+		nodesRepo,
+		10,
+		time.Second*2,
+		1,
+		http_check_health_upds.Thresholds{Fail: 1, Success: 1},
+		nil,
+		http_check_health_upds.FlapDamping{},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer serv.Close()
+
+	var rev, lists atomic.Int64
+	nodesRepo.EXPECT().
+		Revision(ctx, "").
+		RunAndReturn(func(context.Context, string) (uint64, error) {
+			return uint64(rev.Load()), nil
+		})
+
+	nodesRepo.EXPECT().
+		GetAll(ctx).
+		RunAndReturn(func(context.Context) ([]model.Node, error) {
+			lists.Add(1)
+			return []model.Node{{
+				ID:             "node_id",
+				State:          model.StateUp,
+				HealthEndpoint: serv.URL,
+			}}, nil
+		})
+
+	go func() { _ = ex.Start(ctx) }()
+
+	time.Sleep(time.Second)
+	assert.EqualValues(t, 1, lists.Load())
+
+	rev.Add(1)
+	assert.Eventually(t, func() bool { return lists.Load() == 2 }, time.Millisecond*500, time.Millisecond*10)
 }
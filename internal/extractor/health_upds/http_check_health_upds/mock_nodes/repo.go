@@ -81,6 +81,63 @@ func (_c *MockReadOnlyRepo_GetAll_Call) RunAndReturn(run func(context.Context) (
 	return _c
 }
 
+// Revision provides a mock function with given fields: ctx, serviceName
+func (_m *MockReadOnlyRepo) Revision(ctx context.Context, serviceName string) (uint64, error) {
+	ret := _m.Called(ctx, serviceName)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Revision")
+	}
+
+	var r0 uint64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (uint64, error)); ok {
+		return rf(ctx, serviceName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) uint64); ok {
+		r0 = rf(ctx, serviceName)
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, serviceName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockReadOnlyRepo_Revision_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Revision'
+type MockReadOnlyRepo_Revision_Call struct {
+	*mock.Call
+}
+
+// Revision is a helper method to define mock.On call
+//   - ctx context.Context
+//   - serviceName string
+func (_e *MockReadOnlyRepo_Expecter) Revision(ctx interface{}, serviceName interface{}) *MockReadOnlyRepo_Revision_Call {
+	return &MockReadOnlyRepo_Revision_Call{Call: _e.mock.On("Revision", ctx, serviceName)}
+}
+
+func (_c *MockReadOnlyRepo_Revision_Call) Run(run func(ctx context.Context, serviceName string)) *MockReadOnlyRepo_Revision_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockReadOnlyRepo_Revision_Call) Return(_a0 uint64, _a1 error) *MockReadOnlyRepo_Revision_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockReadOnlyRepo_Revision_Call) RunAndReturn(run func(context.Context, string) (uint64, error)) *MockReadOnlyRepo_Revision_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockReadOnlyRepo creates a new instance of MockReadOnlyRepo. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockReadOnlyRepo(t interface {
@@ -0,0 +1,105 @@
+package http_check_health_upds
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type scheduleEntry struct {
+	nextAt   time.Time
+	inFlight bool
+}
+
+// schedule tracks when each node is to be checked next.
+type schedule struct {
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+}
+
+func newSchedule() *schedule {
+	return &schedule{
+		entries: map[string]*scheduleEntry{},
+	}
+}
+
+// due syncs schedule with the given nodes and returns the ones
+// to be checked now, most overdue first. New nodes are due at once.
+func (s *schedule) due(nodes []model.Node, now time.Time) []model.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]struct{}, len(nodes))
+	res := []model.Node{}
+
+	for _, node := range nodes {
+		ids[node.ID] = struct{}{}
+
+		e, found := s.entries[node.ID]
+		if !found {
+			e = &scheduleEntry{nextAt: now}
+			s.entries[node.ID] = e
+		}
+
+		if !e.inFlight && !e.nextAt.After(now) {
+			res = append(res, node)
+		}
+	}
+
+	for id := range s.entries {
+		if _, found := ids[id]; !found {
+			delete(s.entries, id)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return s.entries[res[i].ID].nextAt.Before(s.entries[res[j].ID].nextAt)
+	})
+
+	return res
+}
+
+// anyDue reports whether some known node is to be checked now.
+func (s *schedule) anyDue(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if !e.inFlight && !e.nextAt.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// start marks node check as in flight and returns previous check time.
+func (s *schedule) start(id string, nextAt time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, found := s.entries[id]
+	if !found {
+		return time.Time{}
+	}
+
+	prev := e.nextAt
+	e.inFlight = true
+	e.nextAt = nextAt
+	return prev
+}
+
+// finish marks node check as done. Non-zero nextAt overrides next check time.
+func (s *schedule) finish(id string, nextAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, found := s.entries[id]; found {
+		e.inFlight = false
+		if !nextAt.IsZero() {
+			e.nextAt = nextAt
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package http_check_health_upds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+// Thresholds sets how many consecutive probe results
+// are needed to switch node state.
+type Thresholds struct {
+	Fail    int
+	Success int
+}
+
+func (th Thresholds) validate() error {
+	if th.Fail <= 0 {
+		return fmt.Errorf("fail threshold must be positive, got: %d", th.Fail)
+	}
+	if th.Success <= 0 {
+		return fmt.Errorf("success threshold must be positive, got: %d", th.Success)
+	}
+	return nil
+}
+
+// FlapDamping sets flap detection: node making Threshold or more
+// state transitions within Window is considered flapping and gets damped.
+// Damped node is released after Window without transitions.
+// Zero Threshold disables flap detection.
+type FlapDamping struct {
+	Window    time.Duration
+	Threshold int
+}
+
+func (fd FlapDamping) validate() error {
+	if fd.Threshold < 0 {
+		return fmt.Errorf("flap threshold must be non-negative, got: %d", fd.Threshold)
+	}
+	if fd.Threshold > 0 && fd.Window <= 0 {
+		return fmt.Errorf("flap window must be positive, got: %d", fd.Window)
+	}
+	return nil
+}
+
+type nodeStats struct {
+	state       model.State
+	fails       int
+	successes   int
+	transitions []time.Time
+	damped      bool
+}
+
+func (ex *httpCheckHealthUpds) thresholdsFor(serviceName string) Thresholds {
+	if th, found := ex.serviceThresholds[serviceName]; found {
+		return th
+	}
+	return ex.thresholds
+}
+
+// evaluate applies probe result to node counters and returns
+// node update to be emitted, if any.
+// Only transitions changing node routability are counted as flaps.
+func (ex *httpCheckHealthUpds) evaluate(node model.Node, status model.CheckStatus, now time.Time) (model.Node, bool) {
+	ex.statsMu.Lock()
+	defer ex.statsMu.Unlock()
+
+	st, found := ex.stats[node.ID]
+	if !found {
+		st = &nodeStats{damped: node.Damped}
+		ex.stats[node.ID] = st
+	}
+	if !st.damped || !found {
+		st.state = node.State
+	}
+
+	ok := status != model.CheckStatusCritical
+	if ok {
+		st.successes++
+		st.fails = 0
+	} else {
+		st.fails++
+		st.successes = 0
+	}
+
+	prevState := st.state
+	st.state = nextState(st.state, status, st.fails, st.successes, ex.thresholdsFor(node.ServiceName))
+	if st.state.Routable() != prevState.Routable() {
+		st.transitions = append(st.transitions, now)
+	}
+
+	if ex.flap.Threshold > 0 {
+		for len(st.transitions) > 0 && now.Sub(st.transitions[0]) > ex.flap.Window {
+			st.transitions = st.transitions[1:]
+		}
+
+		switch {
+		case !st.damped && len(st.transitions) >= ex.flap.Threshold:
+			st.damped = true
+		case st.damped && len(st.transitions) == 0:
+			st.damped = false
+		}
+	}
+
+	if st.damped {
+		if node.Damped {
+			return model.Node{}, false
+		}
+		node.Damped = true
+		return node, true
+	}
+
+	if node.State == st.state && !node.Damped {
+		return model.Node{}, false
+	}
+
+	node.State = st.state
+	node.Damped = false
+	return node, true
+}
+
+func nextState(cur model.State, status model.CheckStatus, fails int, successes int, th Thresholds) model.State {
+	healthy := model.StateUp
+	if status == model.CheckStatusWarning {
+		healthy = model.StateWarning
+	}
+
+	ok := status != model.CheckStatusCritical
+	switch {
+	case ok && cur.Routable():
+		return healthy
+	case ok && successes >= th.Success:
+		return healthy
+	case ok:
+		return model.StatePassing
+	case fails >= th.Fail:
+		return model.StateCritical
+	case cur.Routable():
+		return model.StateWarning
+	case cur == model.StatePassing:
+		return model.StateCritical
+	default:
+		return cur
+	}
+}
+
+func (ex *httpCheckHealthUpds) cleanupStats(nodes []model.Node) {
+	ids := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		ids[node.ID] = struct{}{}
+	}
+
+	ex.statsMu.Lock()
+	defer ex.statsMu.Unlock()
+
+	for id := range ex.stats {
+		if _, found := ids[id]; !found {
+			delete(ex.stats, id)
+		}
+	}
+}
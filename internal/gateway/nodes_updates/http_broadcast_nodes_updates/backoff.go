@@ -0,0 +1,34 @@
+package http_broadcast_nodes_updates
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backoff sets delay before next delivery to the receiver
+// after consecutive failures: Min doubled with each failure, up to Max.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (b Backoff) validate() error {
+	if b.Min <= 0 {
+		return fmt.Errorf("min backoff must be positive, got: %s", b.Min)
+	}
+	if b.Max < b.Min {
+		return fmt.Errorf("max backoff must not be less than min (%s), got: %s", b.Min, b.Max)
+	}
+	return nil
+}
+
+func (b Backoff) delay(failures int) time.Duration {
+	d := b.Min
+	for range failures - 1 {
+		d *= 2
+		if d >= b.Max {
+			return b.Max
+		}
+	}
+	return d
+}
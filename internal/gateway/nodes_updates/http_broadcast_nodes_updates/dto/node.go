@@ -1,8 +1,18 @@
 package dto
 
+import "time"
+
 type Node struct {
+	// Event is kind of the change: updated or meta-changed.
+	Event       string
 	ID          string
 	Hostname    string
 	ServiceName string
 	State       string
+	Damped      bool
+	Meta        map[string]string
+	// Revision grows monotonically within the service,
+	// so receivers can order updates and detect missed ones.
+	Revision  uint64
+	ChangedAt time.Time
 }
@@ -2,118 +2,449 @@ package http_broadcast_nodes_updates
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/horockey/service_discovery/internal/gateway/nodes_updates"
 	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates/dto"
+	"github.com/horockey/service_discovery/internal/metrics"
 	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+	"github.com/horockey/service_discovery/internal/signature"
+	"github.com/horockey/service_discovery/internal/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ nodes_updates.Gateway = &httpBroadcastNodesUpdates{}
 
 var ErrClosed = errors.New("gateway is closed. Unable to write new message")
 
+const dispatchIvl = time.Millisecond * 500
+
+var tracer = otel.Tracer("github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates")
+
 type httpBroadcastNodesUpdates struct {
 	mu         sync.RWMutex
 	closed     bool
 	cl         *resty.Client
-	sendCh     chan sendTask
+	outbox     outbox.Repository
 	workersNum int
+	backoff    Backoff
+	maxAge     time.Duration
+	wake       chan struct{}
 	logger     zerolog.Logger
+
+	// dirty is set on every change of outbox or receivers, so that
+	// outbox is not rescanned on tick unless something changed.
+	dirty atomic.Bool
+	// expireAt is the time the oldest queued delivery expires at.
+	// It is only accessed by dispatching goroutine.
+	expireAt time.Time
+
+	receiversMu sync.Mutex
+	receivers   map[string]*receiverState
 }
 
-type sendTask struct {
-	msg      *model.Node
-	endpoint string
+type receiverState struct {
+	inFlight bool
+	failures int
+	nextAt   time.Time
 }
 
+// New creates gateway delivering updates through persistent outbox.
+// Failed deliveries are retried with per-receiver backoff
+// and moved to dead letters once older than maxAge.
 func New(
 	workersNum int,
+	outboxRepo outbox.Repository,
+	backoff Backoff,
+	maxAge time.Duration,
 	logger zerolog.Logger,
 ) (*httpBroadcastNodesUpdates, error) {
 	if workersNum <= 0 {
 		return nil, fmt.Errorf("workes num must be positive, got: %d", workersNum)
 	}
+	if err := backoff.validate(); err != nil {
+		return nil, fmt.Errorf("validating backoff: %w", err)
+	}
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("max age must be positive, got: %s", maxAge)
+	}
 
 	return &httpBroadcastNodesUpdates{
 		workersNum: workersNum,
+		outbox:     outboxRepo,
+		backoff:    backoff,
+		maxAge:     maxAge,
+		wake:       make(chan struct{}, 1),
 		logger:     logger,
-		sendCh:     make(chan sendTask, workersNum),
+		receivers:  map[string]*receiverState{},
 		cl: resty.New().
-			SetHeader("Content-Type", "application/json").
-			SetRetryCount(5),
+			SetHeader("Content-Type", "application/json"),
 	}, nil
 }
 
+// Start delivers updates until ctx is done.
+// It may be started again after that, e.g. on each leadership gain.
 func (gw *httpBroadcastNodesUpdates) Start(ctx context.Context) error {
-	var wg sync.WaitGroup
+	gw.mu.Lock()
+	gw.closed = false
+	gw.mu.Unlock()
+
+	tasks := make(chan model.Delivery)
 
+	var wg sync.WaitGroup
 	for range gw.workersNum {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for task := range gw.sendCh {
-				resp, err := gw.cl.R().
-					SetContext(ctx).
-					SetBody(dto.Node{
-						ID:       task.msg.ID,
-						Hostname: task.msg.Hostname,
-						State:    task.msg.State.String(),
-					}).
-					Post(task.endpoint)
-				if err != nil {
-					gw.logger.
-						Error().
-						Str("endpoint", task.endpoint).
-						Err(fmt.Errorf("executing request: %w", err)).
-						Send()
-					continue
-				}
-				if resp.StatusCode() != http.StatusOK {
-					gw.logger.
-						Error().
-						Err(fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())).
-						Send()
-					continue
-				}
+			for d := range tasks {
+				gw.deliver(ctx, d)
 			}
 		}()
 	}
 
-	<-ctx.Done()
+	ticker := time.NewTicker(dispatchIvl)
+	defer ticker.Stop()
 
-	gw.mu.Lock()
-	close(gw.sendCh)
-	gw.closed = true
-	gw.mu.Unlock()
+	// Outbox may be left by previous run.
+	gw.dirty.Store(true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			gw.mu.Lock()
+			gw.closed = true
+			gw.mu.Unlock()
+
+			close(tasks)
+			wg.Wait()
+
+			return fmt.Errorf("running context: %w", ctx.Err())
+		case <-ticker.C:
+		case <-gw.wake:
+		}
 
-	wg.Wait()
+		now := time.Now()
+		if !gw.dirty.Swap(false) && (gw.expireAt.IsZero() || now.Before(gw.expireAt)) {
+			continue
+		}
 
-	return fmt.Errorf("running context: %w", ctx.Err())
+		if err := gw.dispatch(ctx, now, tasks); err != nil {
+			gw.dirty.Store(true)
+			gw.logger.
+				Error().
+				Err(fmt.Errorf("dispatching deliveries: %w", err)).
+				Send()
+		}
+	}
 }
 
-func (gw *httpBroadcastNodesUpdates) Send(ctx context.Context, upd model.Node, recievers []model.Node) error {
+func (gw *httpBroadcastNodesUpdates) Send(ctx context.Context, ev model.Event, recievers []model.Node) error {
 	gw.mu.RLock()
 	defer gw.mu.RUnlock()
 	if gw.closed {
 		return ErrClosed
 	}
 
+	upd := ev.Node
+	ctx, span := tracer.Start(ctx, "gateway.send", trace.WithAttributes(
+		attribute.String("node.id", upd.ID),
+		attribute.String("event.kind", ev.Kind.String()),
+		attribute.Int("receivers", len(recievers)),
+	))
+	defer span.End()
+
+	now := time.Now()
+	traceCtx := tracing.Inject(ctx)
+	ds := make([]model.Delivery, 0, len(recievers))
 	for _, node := range recievers {
 		if node.ID == upd.ID {
 			continue
 		}
 
-		gw.sendCh <- sendTask{
-			msg:      &upd,
-			endpoint: node.UpdEndpoint,
+		ds = append(ds, model.Delivery{
+			ReceiverID: node.ID,
+			Endpoint:   node.UpdEndpoint,
+			Secret:     node.Secret,
+			Kind:       ev.Kind,
+			Upd:        upd,
+			CreatedAt:  now,
+			Trace:      traceCtx,
+		})
+	}
+	if len(ds) == 0 {
+		return nil
+	}
+
+	if err := gw.outbox.Add(ctx, ds); err != nil {
+		return fmt.Errorf("adding deliveries to outbox: %w", err)
+	}
+	gw.notifyDispatcher()
+
+	return nil
+}
+
+// dispatch hands pending deliveries over to idle workers.
+// Every receiver has its own FIFO queue with only its head in flight,
+// so receiver gets updates in the order they were sent.
+// Receivers in backoff are skipped.
+func (gw *httpBroadcastNodesUpdates) dispatch(ctx context.Context, now time.Time, tasks chan<- model.Delivery) error {
+	// Outbox is read under the lock, so that delivery finished
+	// in between is not seen pending and handed out again.
+	gw.receiversMu.Lock()
+	defer gw.receiversMu.Unlock()
+
+	ds, err := gw.outbox.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting deliveries from outbox: %w", err)
+	}
+	metrics.UpdsQueueDepth.Set(float64(len(ds)))
+
+	var (
+		receivers []string
+		queues    = map[string][]model.Delivery{}
+	)
+	for _, d := range ds {
+		if _, found := queues[d.ReceiverID]; !found {
+			receivers = append(receivers, d.ReceiverID)
+		}
+		queues[d.ReceiverID] = append(queues[d.ReceiverID], d)
+	}
+
+	gw.expireAt = time.Time{}
+
+	for id, st := range gw.receivers {
+		if _, found := queues[id]; !found && !st.inFlight {
+			delete(gw.receivers, id)
+		}
+	}
+
+	for _, id := range receivers {
+		st, found := gw.receivers[id]
+		if !found {
+			st = &receiverState{}
+			gw.receivers[id] = st
+		}
+
+		// Head of the queue is in flight, so it must not be touched.
+		queue := queues[id]
+		if st.inFlight {
+			queue = queue[1:]
+		}
+
+		queue, err := gw.prepareQueue(ctx, now, queue)
+		if err != nil {
+			return fmt.Errorf("preparing queue of receiver %s: %w", id, err)
+		}
+		for _, d := range queue {
+			if at := d.CreatedAt.Add(gw.maxAge); gw.expireAt.IsZero() || at.Before(gw.expireAt) {
+				gw.expireAt = at
+			}
+		}
+		if st.inFlight || len(queue) == 0 || now.Before(st.nextAt) {
+			continue
+		}
+
+		// Receivers left while workers are busy are handed out on the next dispatch.
+		select {
+		case tasks <- queue[0]:
+			st.inFlight = true
+		default:
+			gw.dirty.Store(true)
 		}
 	}
 
 	return nil
 }
+
+// prepareQueue moves expired deliveries to dead letters and coalesces
+// deliveries about the same node into the latest one, so that lagging
+// receiver gets final state of the node instead of the whole backlog.
+// Latest delivery is sent as update if any of coalesced ones was,
+// so that state change is not reported as meta change only.
+func (gw *httpBroadcastNodesUpdates) prepareQueue(ctx context.Context, now time.Time, queue []model.Delivery) ([]model.Delivery, error) {
+	latest := map[string]uint64{}
+	updated := map[string]bool{}
+	for _, d := range queue {
+		latest[d.Upd.ID] = d.Seq
+		if d.Kind == model.EventKindUpdated {
+			updated[d.Upd.ID] = true
+		}
+	}
+
+	res := make([]model.Delivery, 0, len(latest))
+	for _, d := range queue {
+		switch {
+		case latest[d.Upd.ID] != d.Seq:
+			if err := gw.outbox.Remove(ctx, d.Seq); err != nil {
+				return nil, fmt.Errorf("removing coalesced delivery: %w", err)
+			}
+		case now.Sub(d.CreatedAt) > gw.maxAge:
+			if err := gw.outbox.MoveToDeadLetters(ctx, d); err != nil {
+				return nil, fmt.Errorf("moving delivery to dead letters: %w", err)
+			}
+			metrics.UpdsDeadLetters.Inc()
+			gw.logger.
+				Warn().
+				Str("receiver_id", d.ReceiverID).
+				Uint64("seq", d.Seq).
+				Str("last_error", d.LastError).
+				Msg("Delivery expired, moved to dead letters")
+		default:
+			if d.Kind == model.EventKindMetaChanged && updated[d.Upd.ID] {
+				d.Kind = model.EventKindUpdated
+				if err := gw.outbox.Update(ctx, d); err != nil {
+					return nil, fmt.Errorf("updating coalesced delivery: %w", err)
+				}
+			}
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+func (gw *httpBroadcastNodesUpdates) deliver(ctx context.Context, d model.Delivery) {
+	// Delivery continues trace of the change, even if it is retried after restart.
+	postCtx, span := tracer.Start(tracing.Extract(ctx, d.Trace), "gateway.deliver", trace.WithAttributes(
+		attribute.String("receiver.id", d.ReceiverID),
+		attribute.Int64("delivery.seq", int64(d.Seq)),
+		attribute.Int("delivery.attempt", d.Attempts+1),
+	))
+	err := gw.post(postCtx, d)
+	tracing.End(span, err)
+	if ctx.Err() != nil {
+		// Delivery stays in outbox and is retried after restart.
+		// It has not failed, so receiver is not put into backoff.
+		gw.release(d.ReceiverID)
+		return
+	}
+
+	if err == nil {
+		if err := gw.outbox.Remove(ctx, d.Seq); err != nil {
+			gw.logger.
+				Error().
+				Err(fmt.Errorf("removing delivery from outbox: %w", err)).
+				Send()
+		}
+		metrics.UpdsDeliveryDuration.Observe(time.Since(d.CreatedAt).Seconds())
+		gw.finish(d.ReceiverID, true)
+		return
+	}
+
+	gw.logger.
+		Error().
+		Str("receiver_id", d.ReceiverID).
+		Str("endpoint", d.Endpoint).
+		Err(err).
+		Send()
+
+	metrics.UpdsDeliveryFailures.Inc()
+	d.Attempts++
+	d.LastError = err.Error()
+	if err := gw.outbox.Update(ctx, d); err != nil {
+		gw.logger.
+			Error().
+			Err(fmt.Errorf("updating delivery in outbox: %w", err)).
+			Send()
+	}
+	gw.finish(d.ReceiverID, false)
+}
+
+func (gw *httpBroadcastNodesUpdates) post(ctx context.Context, d model.Delivery) error {
+	body, err := json.Marshal(dto.Node{
+		Event:       d.Kind.String(),
+		ID:          d.Upd.ID,
+		Hostname:    d.Upd.Hostname,
+		ServiceName: d.Upd.ServiceName,
+		State:       d.Upd.State.String(),
+		Damped:      d.Upd.Damped,
+		Meta:        d.Upd.Meta,
+		Revision:    d.Upd.Revision,
+		ChangedAt:   d.Upd.ChangedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+
+	req := gw.cl.R().
+		SetContext(ctx).
+		SetBody(body)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	// Nodes registered before per-node secrets were introduced have none.
+	if d.Secret != "" {
+		u, err := url.Parse(d.Endpoint)
+		if err != nil {
+			return fmt.Errorf("parsing endpoint: %w", err)
+		}
+		headers, err := signature.Headers(d.Secret, http.MethodPost, u.Path, body, time.Now())
+		if err != nil {
+			return fmt.Errorf("signing request: %w", err)
+		}
+		req.SetHeaders(headers)
+	}
+
+	resp, err := req.Post(d.Endpoint)
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+// finish releases receiver for the next delivery,
+// putting it into backoff if delivery failed.
+func (gw *httpBroadcastNodesUpdates) finish(receiverID string, ok bool) {
+	gw.receiversMu.Lock()
+	st, found := gw.receivers[receiverID]
+	if found {
+		st.inFlight = false
+		if ok {
+			st.failures = 0
+			st.nextAt = time.Time{}
+		} else {
+			st.failures++
+			delay := gw.backoff.delay(st.failures)
+			st.nextAt = time.Now().Add(delay)
+			time.AfterFunc(delay, gw.notifyDispatcher)
+		}
+	}
+	gw.receiversMu.Unlock()
+
+	gw.notifyDispatcher()
+}
+
+// release frees receiver for the next delivery without changing its backoff.
+func (gw *httpBroadcastNodesUpdates) release(receiverID string) {
+	gw.receiversMu.Lock()
+	if st, found := gw.receivers[receiverID]; found {
+		st.inFlight = false
+	}
+	gw.receiversMu.Unlock()
+
+	gw.notifyDispatcher()
+}
+
+func (gw *httpBroadcastNodesUpdates) notifyDispatcher() {
+	gw.dirty.Store(true)
+	select {
+	case gw.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,308 @@
+package http_broadcast_nodes_updates_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates"
+	"github.com/horockey/service_discovery/internal/gateway/nodes_updates/http_broadcast_nodes_updates/dto"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = zerolog.New(zerolog.ConsoleWriter{
+	Out:        os.Stdout,
+	TimeFormat: time.RFC3339,
+}).With().Timestamp().Logger()
+
+func TestGatewayRetries(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+		got      []dto.Node
+	)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		n := dto.Node{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&n))
+		got = append(got, n)
+	}))
+	defer flaky.Close()
+
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+
+	gw, err := http_broadcast_nodes_updates.New(
+		2,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Millisecond * 50, Max: time.Millisecond * 100},
+		time.Second,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() { _ = gw.Start(ctx) }()
+
+	upd := model.Node{
+		ID:          "node1_id",
+		ServiceName: "fooBarService",
+		State:       model.StateCritical,
+		Revision:    1,
+	}
+	require.NoError(t, gw.Send(ctx, model.Event{Kind: model.EventKindMetaChanged, Node: upd}, []model.Node{
+		{ID: "node2_id", UpdEndpoint: flaky.URL + "/updateMe"},
+		{ID: "node3_id", UpdEndpoint: dead.URL + "/updateMe"},
+	}))
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(c, got, 1)
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, upd.ID, got[0].ID)
+	assert.Equal(t, upd.ServiceName, got[0].ServiceName)
+	assert.Equal(t, upd.State.String(), got[0].State)
+	assert.Equal(t, model.EventKindMetaChanged.String(), got[0].Event)
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		ds, err := outboxRepo.GetDeadLetters(ctx)
+		assert.NoError(c, err)
+		assert.Len(c, ds, 1)
+	}, time.Second*3, time.Millisecond*50)
+
+	pending, err := outboxRepo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	ds, err := outboxRepo.GetDeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "node3_id", ds[0].ReceiverID)
+	assert.Positive(t, ds[0].Attempts)
+	assert.NotEmpty(t, ds[0].LastError)
+}
+
+func TestGatewayOrderAndCoalescing(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		got     []dto.Node
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := dto.Node{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&n))
+
+		if n.Revision == 1 {
+			close(entered)
+			<-release
+		}
+
+		mu.Lock()
+		got = append(got, n)
+		mu.Unlock()
+	}))
+	defer slow.Close()
+
+	gw, err := http_broadcast_nodes_updates.New(
+		4,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Millisecond * 50, Max: time.Millisecond * 100},
+		time.Minute,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() { _ = gw.Start(ctx) }()
+
+	receivers := []model.Node{{ID: "receiver_id", UpdEndpoint: slow.URL + "/updateMe"}}
+	send := func(kind model.EventKind, id string, state model.State, rev uint64) {
+		require.NoError(t, gw.Send(ctx, model.Event{Kind: kind, Node: model.Node{ID: id, State: state, Revision: rev}}, receivers))
+	}
+
+	send(model.EventKindUpdated, "node1_id", model.StateUp, 1)
+	<-entered
+
+	send(model.EventKindUpdated, "node1_id", model.StateCritical, 2)
+	send(model.EventKindUpdated, "node2_id", model.StateCritical, 3)
+	send(model.EventKindUpdated, "node1_id", model.StateUp, 4)
+	// State change of node2 is not hidden by the later meta change.
+	send(model.EventKindMetaChanged, "node2_id", model.StateCritical, 5)
+	send(model.EventKindMetaChanged, "node3_id", model.StateUp, 6)
+	close(release)
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		pending, err := outboxRepo.GetAll(ctx)
+		assert.NoError(c, err)
+		assert.Empty(c, pending)
+	}, time.Second, time.Millisecond*10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, 4)
+	assert.Equal(
+		t,
+		[]uint64{1, 4, 5, 6},
+		[]uint64{got[0].Revision, got[1].Revision, got[2].Revision, got[3].Revision},
+	)
+	assert.Equal(
+		t,
+		[]string{"updated", "updated", "updated", "meta-changed"},
+		[]string{got[0].Event, got[1].Event, got[2].Event, got[3].Event},
+	)
+}
+
+func TestGatewayCoalescingWhileBusy(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	// Backlog is left by previous run. The only worker is blocked by the first receiver.
+	ds := []model.Delivery{{ReceiverID: "receiver1_id", Upd: model.Node{ID: "node1_id", Revision: 1}}}
+	for _, receiverID := range []string{"receiver2_id", "receiver3_id"} {
+		for rev := range uint64(3) {
+			ds = append(ds, model.Delivery{ReceiverID: receiverID, Upd: model.Node{ID: "node2_id", Revision: rev + 2}})
+		}
+	}
+	for i := range ds {
+		ds[i].Endpoint = slow.URL + "/updateMe"
+		ds[i].CreatedAt = time.Now()
+	}
+	require.NoError(t, outboxRepo.Add(ctx, ds))
+
+	gw, err := http_broadcast_nodes_updates.New(
+		1,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Millisecond * 50, Max: time.Millisecond * 100},
+		time.Minute,
+		logger,
+	)
+	require.NoError(t, err)
+	go func() { _ = gw.Start(ctx) }()
+
+	// Queues of all waiting receivers are coalesced.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		pending, err := outboxRepo.GetAll(ctx)
+		assert.NoError(c, err)
+		assert.Len(c, pending, 3)
+	}, time.Second*2, time.Millisecond*10)
+}
+
+func TestGatewayRestartWithoutBackoff(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	outboxRepo, err := badger_outbox.New(db)
+	require.NoError(t, err)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	started := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+
+		// The first delivery is interrupted by stop of the gateway.
+		// Body is read, so that server notices client disconnect.
+		if first {
+			_, _ = io.Copy(io.Discard, req.Body)
+			close(started)
+			<-req.Context().Done()
+		}
+	}))
+	defer receiver.Close()
+
+	gw, err := http_broadcast_nodes_updates.New(
+		1,
+		outboxRepo,
+		http_broadcast_nodes_updates.Backoff{Min: time.Minute, Max: time.Minute},
+		time.Hour,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	firstCtx, firstCancel := context.WithCancel(ctx)
+	go func() { _ = gw.Start(firstCtx) }()
+
+	require.NoError(t, gw.Send(ctx, model.Event{Kind: model.EventKindUpdated, Node: model.Node{ID: "node1_id"}}, []model.Node{
+		{ID: "node2_id", UpdEndpoint: receiver.URL + "/updateMe"},
+	}))
+
+	select {
+	case <-started:
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "delivery is not started")
+	}
+	firstCancel()
+
+	// Interrupted delivery is not a failure, so it is retried right after restart.
+	go func() { _ = gw.Start(ctx) }()
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		pending, err := outboxRepo.GetAll(ctx)
+		assert.NoError(c, err)
+		assert.Empty(c, pending)
+	}, time.Second*2, time.Millisecond*10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, attempts)
+}
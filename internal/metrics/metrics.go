@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "discovery"
+
+// Registry holds all metrics of the service.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	StateTransitions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "state_transitions_total",
+		Help:      "Node state transitions.",
+	}, []string{"service", "from", "to"})
+
+	CheckDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "healthcheck_duration_seconds",
+		Help:      "Duration of node health checks, including retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	CheckFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "healthcheck_failures_total",
+		Help:      "Failed node health checks.",
+	}, []string{"kind", "reason"})
+
+	UpdsQueueDepth = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upds_queue_depth",
+		Help:      "Node updates waiting for delivery in outbox.",
+	})
+
+	UpdsDeliveryDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upds_delivery_duration_seconds",
+		Help:      "Time from sending node update to its successful delivery.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 10),
+	})
+
+	UpdsDeliveryFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upds_delivery_failures_total",
+		Help:      "Failed node update delivery attempts.",
+	})
+
+	UpdsDeadLetters = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upds_dead_letters_total",
+		Help:      "Node updates moved to dead letters.",
+	})
+
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Handled HTTP requests.",
+	}, []string{"method", "route", "code"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests. Blocking queries and watches last up to their wait.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// CheckFailureReason classifies failed health check for metrics labels.
+func CheckFailureReason(err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return "unhealthy"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "error"
+	}
+}
+
+// NodesRepo is the source of node counts.
+type NodesRepo interface {
+	GetAll(ctx context.Context) ([]model.Node, error)
+}
+
+// RegisterNodes registers gauge of node counts by service and state,
+// computed from repo on every scrape.
+func RegisterNodes(repo NodesRepo) error {
+	return Registry.Register(&nodesCollector{
+		repo: repo,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "nodes"),
+			"Registered nodes.",
+			[]string{"service", "state"},
+			nil,
+		),
+	})
+}
+
+// RegisterBadger registers gauges of badger LSM tree and value log sizes.
+func RegisterBadger(db *badger.DB) error {
+	for _, kind := range []string{"lsm", "vlog"} {
+		err := Registry.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace:   namespace,
+				Name:        "badger_size_bytes",
+				Help:        "Size of badger database on disk.",
+				ConstLabels: prometheus.Labels{"kind": kind},
+			},
+			func() float64 {
+				lsm, vlog := db.Size()
+				if kind == "lsm" {
+					return float64(lsm)
+				}
+				return float64(vlog)
+			},
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const collectTimeout = time.Second * 5
+
+type nodesCollector struct {
+	repo NodesRepo
+	desc *prometheus.Desc
+}
+
+func (c *nodesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *nodesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	nodes, err := c.repo.GetAll(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	type key struct {
+		service string
+		state   model.State
+	}
+	counts := map[key]int{}
+	for _, n := range nodes {
+		counts[key{n.ServiceName, n.State}]++
+	}
+
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc,
+			prometheus.GaugeValue,
+			float64(count),
+			k.service,
+			k.state.String(),
+		)
+	}
+}
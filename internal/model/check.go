@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+//go:generate go-enum --values
+
+// Kind of the node health check:
+//   - http: discovery polls node HealthEndpoint;
+//   - ttl: node reports its health by heartbeats, missing heartbeat
+//     for TTL means failure;
+//   - tcp: discovery connects to Address;
+//   - grpc: discovery calls grpc.health.v1.Health/Check on Address;
+//   - exec: discovery runs local Command, exit code 0 means passing,
+//     1 means warning, any other means critical.
+//
+// ENUM(http, ttl, tcp, grpc, exec)
+type CheckKind int
+
+const (
+	// MinCheckInterval is the least interval between probes node may request.
+	MinCheckInterval = time.Second
+	// MinTTL is the least ttl of heartbeats node may request.
+	MinTTL = time.Second
+)
+
+type Check struct {
+	Kind CheckKind
+	// Zero Interval, Timeout and Retries mean discovery defaults.
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+	TTL      time.Duration
+	// Address for tcp and grpc checks. Node Hostname is used if empty.
+	Address     string
+	GRPCService string
+	GRPCUseTLS  bool
+	// Expected response statuses for http check. 200 is expected if empty.
+	ExpectedStatuses []int
+	// Regexp the http check response body must match.
+	BodyMatch     string
+	Method        string
+	Headers       map[string]string
+	TLSSkipVerify bool
+	Command       []string
+}
@@ -0,0 +1,79 @@
+// Code generated by go-enum DO NOT EDIT.
+// Version: 0.5.7
+// Revision: bf63e108589bbd2327b13ec2c5da532aad234029
+// Build Date: 2023-07-25T23:27:55Z
+// Built By: goreleaser
+
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// CheckKindHttp is a CheckKind of type Http.
+	CheckKindHttp CheckKind = iota
+	// CheckKindTtl is a CheckKind of type Ttl.
+	CheckKindTtl
+	// CheckKindTcp is a CheckKind of type Tcp.
+	CheckKindTcp
+	// CheckKindGrpc is a CheckKind of type Grpc.
+	CheckKindGrpc
+	// CheckKindExec is a CheckKind of type Exec.
+	CheckKindExec
+)
+
+var ErrInvalidCheckKind = errors.New("not a valid CheckKind")
+
+const _CheckKindName = "httpttltcpgrpcexec"
+
+// CheckKindValues returns a list of the values for CheckKind
+func CheckKindValues() []CheckKind {
+	return []CheckKind{
+		CheckKindHttp,
+		CheckKindTtl,
+		CheckKindTcp,
+		CheckKindGrpc,
+		CheckKindExec,
+	}
+}
+
+var _CheckKindMap = map[CheckKind]string{
+	CheckKindHttp: _CheckKindName[0:4],
+	CheckKindTtl:  _CheckKindName[4:7],
+	CheckKindTcp:  _CheckKindName[7:10],
+	CheckKindGrpc: _CheckKindName[10:14],
+	CheckKindExec: _CheckKindName[14:18],
+}
+
+// String implements the Stringer interface.
+func (x CheckKind) String() string {
+	if str, ok := _CheckKindMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("CheckKind(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x CheckKind) IsValid() bool {
+	_, ok := _CheckKindMap[x]
+	return ok
+}
+
+var _CheckKindValue = map[string]CheckKind{
+	_CheckKindName[0:4]:   CheckKindHttp,
+	_CheckKindName[4:7]:   CheckKindTtl,
+	_CheckKindName[7:10]:  CheckKindTcp,
+	_CheckKindName[10:14]: CheckKindGrpc,
+	_CheckKindName[14:18]: CheckKindExec,
+}
+
+// ParseCheckKind attempts to convert a string to a CheckKind.
+func ParseCheckKind(name string) (CheckKind, error) {
+	if x, ok := _CheckKindValue[name]; ok {
+		return x, nil
+	}
+	return CheckKind(0), fmt.Errorf("%s is %w", name, ErrInvalidCheckKind)
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+//go:generate go-enum --values
+
+// Result of the single health check.
+// Warning counts as success, but node stays in warning state.
+//
+// ENUM(passing, warning, critical)
+type CheckStatus int
+
+type Heartbeat struct {
+	At     time.Time
+	Status CheckStatus
+	Note   string
+}
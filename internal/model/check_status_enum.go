@@ -0,0 +1,69 @@
+// Code generated by go-enum DO NOT EDIT.
+// Version: 0.5.7
+// Revision: bf63e108589bbd2327b13ec2c5da532aad234029
+// Build Date: 2023-07-25T23:27:55Z
+// Built By: goreleaser
+
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// CheckStatusPassing is a CheckStatus of type Passing.
+	CheckStatusPassing CheckStatus = iota
+	// CheckStatusWarning is a CheckStatus of type Warning.
+	CheckStatusWarning
+	// CheckStatusCritical is a CheckStatus of type Critical.
+	CheckStatusCritical
+)
+
+var ErrInvalidCheckStatus = errors.New("not a valid CheckStatus")
+
+const _CheckStatusName = "passingwarningcritical"
+
+// CheckStatusValues returns a list of the values for CheckStatus
+func CheckStatusValues() []CheckStatus {
+	return []CheckStatus{
+		CheckStatusPassing,
+		CheckStatusWarning,
+		CheckStatusCritical,
+	}
+}
+
+var _CheckStatusMap = map[CheckStatus]string{
+	CheckStatusPassing:  _CheckStatusName[0:7],
+	CheckStatusWarning:  _CheckStatusName[7:14],
+	CheckStatusCritical: _CheckStatusName[14:22],
+}
+
+// String implements the Stringer interface.
+func (x CheckStatus) String() string {
+	if str, ok := _CheckStatusMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("CheckStatus(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x CheckStatus) IsValid() bool {
+	_, ok := _CheckStatusMap[x]
+	return ok
+}
+
+var _CheckStatusValue = map[string]CheckStatus{
+	_CheckStatusName[0:7]:   CheckStatusPassing,
+	_CheckStatusName[7:14]:  CheckStatusWarning,
+	_CheckStatusName[14:22]: CheckStatusCritical,
+}
+
+// ParseCheckStatus attempts to convert a string to a CheckStatus.
+func ParseCheckStatus(name string) (CheckStatus, error) {
+	if x, ok := _CheckStatusValue[name]; ok {
+		return x, nil
+	}
+	return CheckStatus(0), fmt.Errorf("%s is %w", name, ErrInvalidCheckStatus)
+}
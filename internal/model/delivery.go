@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Delivery is node update pending delivery to one of its peers.
+type Delivery struct {
+	Seq        uint64
+	ReceiverID string
+	Endpoint   string
+	Secret     string
+	Kind       EventKind
+	Upd        Node
+	CreatedAt  time.Time
+	Attempts   int
+	LastError  string
+	// Trace is trace context of the change being delivered.
+	Trace map[string]string
+}
@@ -0,0 +1,15 @@
+package model
+
+//go:generate go-enum --values
+
+// Kind of the node change.
+//
+// ENUM(updated, removed, meta-changed)
+type EventKind int
+
+// Event describes node change. Node.Revision is the service revision
+// the change was made at, Node.ChangedAt is its time.
+type Event struct {
+	Kind EventKind
+	Node Node
+}
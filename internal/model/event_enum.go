@@ -0,0 +1,69 @@
+// Code generated by go-enum DO NOT EDIT.
+// Version: 0.5.7
+// Revision: bf63e108589bbd2327b13ec2c5da532aad234029
+// Build Date: 2023-07-25T23:27:55Z
+// Built By: goreleaser
+
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// EventKindUpdated is a EventKind of type Updated.
+	EventKindUpdated EventKind = iota
+	// EventKindRemoved is a EventKind of type Removed.
+	EventKindRemoved
+	// EventKindMetaChanged is a EventKind of type Meta-Changed.
+	EventKindMetaChanged
+)
+
+var ErrInvalidEventKind = errors.New("not a valid EventKind")
+
+const _EventKindName = "updatedremovedmeta-changed"
+
+// EventKindValues returns a list of the values for EventKind
+func EventKindValues() []EventKind {
+	return []EventKind{
+		EventKindUpdated,
+		EventKindRemoved,
+		EventKindMetaChanged,
+	}
+}
+
+var _EventKindMap = map[EventKind]string{
+	EventKindUpdated:     _EventKindName[0:7],
+	EventKindRemoved:     _EventKindName[7:14],
+	EventKindMetaChanged: _EventKindName[14:26],
+}
+
+// String implements the Stringer interface.
+func (x EventKind) String() string {
+	if str, ok := _EventKindMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("EventKind(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x EventKind) IsValid() bool {
+	_, ok := _EventKindMap[x]
+	return ok
+}
+
+var _EventKindValue = map[string]EventKind{
+	_EventKindName[0:7]:   EventKindUpdated,
+	_EventKindName[7:14]:  EventKindRemoved,
+	_EventKindName[14:26]: EventKindMetaChanged,
+}
+
+// ParseEventKind attempts to convert a string to a EventKind.
+func ParseEventKind(name string) (EventKind, error) {
+	if x, ok := _EventKindValue[name]; ok {
+		return x, nil
+	}
+	return EventKind(0), fmt.Errorf("%s is %w", name, ErrInvalidEventKind)
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type Maintenance struct {
+	Reason string
+	Since  time.Time
+	// Zero Until means maintenance lasts until explicit exit.
+	Until time.Time
+}
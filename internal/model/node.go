@@ -1,11 +1,31 @@
 package model
 
+import "time"
+
 type Node struct {
 	ID             string
 	Hostname       string
 	ServiceName    string
 	State          State
+	Damped         bool
 	HealthEndpoint string
 	UpdEndpoint    string
 	Meta           map[string]string
+	Maintenance    *Maintenance
+	Check          Check
+	Heartbeat      *Heartbeat
+	RegisteredAt   time.Time
+	// Revision is revision of the service at the moment of
+	// the last node change broadcast to its peers.
+	Revision  uint64
+	ChangedAt time.Time
+	// Secret is used to sign requests from discovery to the node.
+	// It is handed to the node only once, on registration.
+	Secret string
+	// Datacenter is set on nodes of datacenter-aware listings only.
+	// It is not stored.
+	Datacenter string `json:"-"`
+	// Trace carries trace context of the node update
+	// from the extractor to usecase. It is not stored.
+	Trace map[string]string `json:"-"`
 }
@@ -1,9 +1,79 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrSecretMismatch is returned on re-registration of the live node without its secret.
+	ErrSecretMismatch = errors.New("node secret mismatch")
+)
+
+var nodeIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RegisterNodeRequest registers new node or updates the registered one.
+// It is the node with ID if set, or the node of the service on the same host otherwise.
 type RegisterNodeRequest struct {
+	ID             string
 	Hostname       string
 	ServiceName    string
 	HealthEndpoint string
 	UpdEndpoint    string
 	Meta           map[string]string
+	Check          Check
+	// Secret of the registered node. It is required to update the node
+	// unless the node is down or critical.
+	Secret string
+}
+
+func (req RegisterNodeRequest) Validate() error {
+	if req.ID != "" && !nodeIDRe.MatchString(req.ID) {
+		return fmt.Errorf("%w: bad node id: %q", ErrInvalidRequest, req.ID)
+	}
+	if req.Check.Interval != 0 && req.Check.Interval < MinCheckInterval {
+		return fmt.Errorf("%w: interval must be at least %s, got: %s", ErrInvalidRequest, MinCheckInterval, req.Check.Interval)
+	}
+	if req.Check.Timeout < 0 {
+		return fmt.Errorf("%w: timeout must be non-negative, got: %s", ErrInvalidRequest, req.Check.Timeout)
+	}
+	// Every probe attempt is cut at interval, so longer timeout would never pass.
+	if req.Check.Interval != 0 && req.Check.Timeout > req.Check.Interval {
+		return fmt.Errorf("%w: timeout %s exceeds interval %s", ErrInvalidRequest, req.Check.Timeout, req.Check.Interval)
+	}
+	if req.Check.Retries < 0 {
+		return fmt.Errorf("%w: retries must be non-negative, got: %d", ErrInvalidRequest, req.Check.Retries)
+	}
+
+	switch req.Check.Kind {
+	case CheckKindHttp:
+		if req.HealthEndpoint == "" {
+			return fmt.Errorf("%w: missing health endpoint for %s check", ErrInvalidRequest, req.Check.Kind)
+		}
+		if _, err := regexp.Compile(req.Check.BodyMatch); err != nil {
+			return fmt.Errorf("%w: compiling body match regexp: %w", ErrInvalidRequest, err)
+		}
+		if strings.ContainsAny(req.Check.Method, " \t\r\n") {
+			return fmt.Errorf("%w: bad http method: %q", ErrInvalidRequest, req.Check.Method)
+		}
+	case CheckKindTtl:
+		if req.Check.TTL < MinTTL {
+			return fmt.Errorf("%w: ttl must be at least %s, got: %s", ErrInvalidRequest, MinTTL, req.Check.TTL)
+		}
+	case CheckKindTcp, CheckKindGrpc:
+		if req.Check.Address == "" && req.Hostname == "" {
+			return fmt.Errorf("%w: missing address for %s check", ErrInvalidRequest, req.Check.Kind)
+		}
+	case CheckKindExec:
+		if len(req.Check.Command) == 0 {
+			return fmt.Errorf("%w: missing command for %s check", ErrInvalidRequest, req.Check.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, req.Check.Kind)
+	}
+
+	return nil
 }
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterNodeRequestCheckTiming(t *testing.T) {
+	req := RegisterNodeRequest{
+		ServiceName:    "foo",
+		HealthEndpoint: "http://host1:8080/health",
+		Check:          Check{Kind: CheckKindHttp},
+	}
+	assert.NoError(t, req.Validate())
+
+	for _, tc := range []struct {
+		interval, timeout time.Duration
+		valid             bool
+	}{
+		{interval: time.Second * 10, timeout: time.Second * 3, valid: true},
+		{interval: time.Second, timeout: time.Second, valid: true},
+		{timeout: time.Second * 30, valid: true},
+		{interval: time.Millisecond},
+		{interval: -time.Second},
+		{interval: time.Second * 2, timeout: time.Second * 3},
+		{timeout: -time.Second},
+	} {
+		req.Check.Interval, req.Check.Timeout = tc.interval, tc.timeout
+		err := req.Validate()
+		if tc.valid {
+			assert.NoError(t, err, "%s/%s", tc.interval, tc.timeout)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidRequest, "%s/%s", tc.interval, tc.timeout)
+		}
+	}
+}
+
+func TestRegisterNodeRequestTTL(t *testing.T) {
+	req := RegisterNodeRequest{
+		ServiceName: "foo",
+		Check:       Check{Kind: CheckKindTtl},
+	}
+
+	for _, tc := range []struct {
+		ttl   time.Duration
+		valid bool
+	}{
+		{ttl: time.Minute, valid: true},
+		{ttl: MinTTL, valid: true},
+		{ttl: time.Millisecond},
+		{ttl: time.Nanosecond},
+		{ttl: 0},
+		{ttl: -time.Second},
+	} {
+		req.Check.TTL = tc.ttl
+		err := req.Validate()
+		if tc.valid {
+			assert.NoError(t, err, tc.ttl)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidRequest, tc.ttl)
+		}
+	}
+}
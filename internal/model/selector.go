@@ -0,0 +1,173 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+//go:generate go-enum --values
+
+// SelectorOp is operator of selector requirement over node Meta.
+// ENUM(eq, neq, in, notin, exists, notexists)
+type SelectorOp int
+
+var setRequirementRe = regexp.MustCompile(`^([^\s!=(),]+)\s+(in|notin)\s*\((.*)\)$`)
+
+type Requirement struct {
+	Key    string
+	Op     SelectorOp
+	Values []string
+}
+
+// Selector matches nodes by Meta and state.
+// Empty selector matches every node.
+type Selector struct {
+	Requirements []Requirement
+	// States limits nodes to the given states, if set.
+	States []State
+}
+
+// ParseSelector parses comma-separated requirements in label selector form:
+//   - key=value, key==value: Meta has the key with the value;
+//   - key!=value: Meta has no key with the value;
+//   - key in (v1,v2), key notin (v1,v2): Meta has the key with one of values,
+//     or has no key with any of them;
+//   - key, !key: Meta has the key, or does not have it.
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{}
+
+	parts, err := splitRequirements(s)
+	if err != nil {
+		return Selector{}, err
+	}
+	for _, part := range parts {
+		req, err := parseRequirement(part)
+		if err != nil {
+			return Selector{}, fmt.Errorf("%w: parsing requirement %q: %w", ErrInvalidRequest, part, err)
+		}
+		sel.Requirements = append(sel.Requirements, req)
+	}
+
+	return sel, nil
+}
+
+// ParseStates parses comma-separated list of node states.
+func ParseStates(s string) ([]State, error) {
+	var res []State
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		st, err := ParseState(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+func (sel Selector) Matches(n Node) bool {
+	if len(sel.States) > 0 && !slices.Contains(sel.States, n.State) {
+		return false
+	}
+
+	for _, req := range sel.Requirements {
+		val, found := n.Meta[req.Key]
+		var ok bool
+		switch req.Op {
+		case SelectorOpEq, SelectorOpIn:
+			ok = found && slices.Contains(req.Values, val)
+		case SelectorOpNeq, SelectorOpNotin:
+			ok = !found || !slices.Contains(req.Values, val)
+		case SelectorOpExists:
+			ok = found
+		case SelectorOpNotexists:
+			ok = !found
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitRequirements splits selector by commas outside of parentheses.
+func splitRequirements(s string) ([]string, error) {
+	var (
+		res   []string
+		depth int
+		start int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced parentheses in selector", ErrInvalidRequest)
+			}
+		case ',':
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced parentheses in selector", ErrInvalidRequest)
+	}
+	res = append(res, s[start:])
+
+	return slices.DeleteFunc(res, func(el string) bool {
+		return strings.TrimSpace(el) == ""
+	}), nil
+}
+
+func parseRequirement(s string) (Requirement, error) {
+	s = strings.TrimSpace(s)
+
+	if key, found := strings.CutPrefix(s, "!"); found {
+		return newRequirement(key, SelectorOpNotexists, nil)
+	}
+
+	if m := setRequirementRe.FindStringSubmatch(s); m != nil {
+		op, err := ParseSelectorOp(m[2])
+		if err != nil {
+			return Requirement{}, err
+		}
+		var vals []string
+		for v := range strings.SplitSeq(m[3], ",") {
+			vals = append(vals, strings.TrimSpace(v))
+		}
+		return newRequirement(m[1], op, vals)
+	}
+
+	for _, sep := range []struct {
+		str string
+		op  SelectorOp
+	}{
+		{"!=", SelectorOpNeq},
+		{"==", SelectorOpEq},
+		{"=", SelectorOpEq},
+	} {
+		if key, val, found := strings.Cut(s, sep.str); found {
+			return newRequirement(key, sep.op, []string{strings.TrimSpace(val)})
+		}
+	}
+
+	return newRequirement(s, SelectorOpExists, nil)
+}
+
+func newRequirement(key string, op SelectorOp, vals []string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " \t!=(),") {
+		return Requirement{}, fmt.Errorf("bad key %q", key)
+	}
+	return Requirement{Key: key, Op: op, Values: vals}, nil
+}
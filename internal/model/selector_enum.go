@@ -0,0 +1,84 @@
+// Code generated by go-enum DO NOT EDIT.
+// Version: 0.5.7
+// Revision: bf63e108589bbd2327b13ec2c5da532aad234029
+// Build Date: 2023-07-25T23:27:55Z
+// Built By: goreleaser
+
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// SelectorOpEq is a SelectorOp of type Eq.
+	SelectorOpEq SelectorOp = iota
+	// SelectorOpNeq is a SelectorOp of type Neq.
+	SelectorOpNeq
+	// SelectorOpIn is a SelectorOp of type In.
+	SelectorOpIn
+	// SelectorOpNotin is a SelectorOp of type Notin.
+	SelectorOpNotin
+	// SelectorOpExists is a SelectorOp of type Exists.
+	SelectorOpExists
+	// SelectorOpNotexists is a SelectorOp of type Notexists.
+	SelectorOpNotexists
+)
+
+var ErrInvalidSelectorOp = errors.New("not a valid SelectorOp")
+
+const _SelectorOpName = "eqneqinnotinexistsnotexists"
+
+// SelectorOpValues returns a list of the values for SelectorOp
+func SelectorOpValues() []SelectorOp {
+	return []SelectorOp{
+		SelectorOpEq,
+		SelectorOpNeq,
+		SelectorOpIn,
+		SelectorOpNotin,
+		SelectorOpExists,
+		SelectorOpNotexists,
+	}
+}
+
+var _SelectorOpMap = map[SelectorOp]string{
+	SelectorOpEq:        _SelectorOpName[0:2],
+	SelectorOpNeq:       _SelectorOpName[2:5],
+	SelectorOpIn:        _SelectorOpName[5:7],
+	SelectorOpNotin:     _SelectorOpName[7:12],
+	SelectorOpExists:    _SelectorOpName[12:18],
+	SelectorOpNotexists: _SelectorOpName[18:27],
+}
+
+// String implements the Stringer interface.
+func (x SelectorOp) String() string {
+	if str, ok := _SelectorOpMap[x]; ok {
+		return str
+	}
+	return fmt.Sprintf("SelectorOp(%d)", x)
+}
+
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x SelectorOp) IsValid() bool {
+	_, ok := _SelectorOpMap[x]
+	return ok
+}
+
+var _SelectorOpValue = map[string]SelectorOp{
+	_SelectorOpName[0:2]:   SelectorOpEq,
+	_SelectorOpName[2:5]:   SelectorOpNeq,
+	_SelectorOpName[5:7]:   SelectorOpIn,
+	_SelectorOpName[7:12]:  SelectorOpNotin,
+	_SelectorOpName[12:18]: SelectorOpExists,
+	_SelectorOpName[18:27]: SelectorOpNotexists,
+}
+
+// ParseSelectorOp attempts to convert a string to a SelectorOp.
+func ParseSelectorOp(name string) (SelectorOp, error) {
+	if x, ok := _SelectorOpValue[name]; ok {
+		return x, nil
+	}
+	return SelectorOp(0), fmt.Errorf("%s is %w", name, ErrInvalidSelectorOp)
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	sel, err := ParseSelector("zone=a, version!=2,shard in (1, 2),canary,!legacy")
+	require.NoError(t, err)
+	assert.Equal(t, []Requirement{
+		{Key: "zone", Op: SelectorOpEq, Values: []string{"a"}},
+		{Key: "version", Op: SelectorOpNeq, Values: []string{"2"}},
+		{Key: "shard", Op: SelectorOpIn, Values: []string{"1", "2"}},
+		{Key: "canary", Op: SelectorOpExists},
+		{Key: "legacy", Op: SelectorOpNotexists},
+	}, sel.Requirements)
+
+	matching := map[string]string{"zone": "a", "version": "1", "shard": "2", "canary": ""}
+	assert.True(t, sel.Matches(Node{Meta: matching}))
+
+	for key, val := range map[string]string{
+		"zone":    "b",
+		"version": "2",
+		"shard":   "3",
+		"legacy":  "true",
+	} {
+		meta := map[string]string{}
+		for k, v := range matching {
+			meta[k] = v
+		}
+		meta[key] = val
+		assert.False(t, sel.Matches(Node{Meta: meta}), key)
+	}
+
+	sel.States, err = ParseStates("up,warning")
+	require.NoError(t, err)
+	assert.True(t, sel.Matches(Node{Meta: matching, State: StateWarning}))
+	assert.False(t, sel.Matches(Node{Meta: matching, State: StateCritical}))
+
+	empty, err := ParseSelector("")
+	require.NoError(t, err)
+	assert.True(t, empty.Matches(Node{}))
+
+	for _, bad := range []string{"a in (1", "=a", "a b", "!", "a in 1"} {
+		_, err := ParseSelector(bad)
+		assert.ErrorIs(t, err, ErrInvalidRequest, bad)
+	}
+	_, err = ParseStates("up,sleeping")
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
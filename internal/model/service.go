@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Service is summary of the service nodes.
+type Service struct {
+	Name  string
+	Total int
+	// Up is number of nodes receiving traffic, Down is number of the rest.
+	Up   int
+	Down int
+	// FirstSeen is registration time of the oldest node.
+	FirstSeen  time.Time
+	LastChange time.Time
+	MetaKeys   []string
+}
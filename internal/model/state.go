@@ -1,6 +1,60 @@
 package model
 
+import "errors"
+
 //go:generate go-enum --values
 
-// ENUM(down, up)
+// State of the node:
+//   - down: node is deregistered and waits for removal;
+//   - up: node is healthy;
+//   - starting: node is registered but not checked yet;
+//   - passing: checks pass, but success threshold is not reached yet;
+//   - warning: checks fail, but failure threshold is not reached yet,
+//     or node reports warning by itself;
+//   - draining: node is being taken out of rotation;
+//   - maintenance: node is out of rotation, checks are paused;
+//   - critical: checks fail and failure threshold is reached.
+//
+// ENUM(down, up, starting, passing, warning, draining, maintenance, critical)
 type State int
+
+var ErrInvalidStateTransition = errors.New("invalid state transition")
+
+var stateTransitions = map[State][]State{
+	StateDown:        {StateStarting},
+	StateUp:          {StateWarning, StateCritical, StateDraining, StateMaintenance, StateDown},
+	StateStarting:    {StatePassing, StateUp, StateWarning, StateCritical, StateDraining, StateMaintenance, StateDown},
+	StatePassing:     {StateUp, StateWarning, StateCritical, StateDraining, StateMaintenance, StateDown},
+	StateWarning:     {StateUp, StateCritical, StateDraining, StateMaintenance, StateDown},
+	StateDraining:    {StateMaintenance, StateStarting, StateDown},
+	StateMaintenance: {StateStarting, StateDown},
+	StateCritical:    {StatePassing, StateUp, StateWarning, StateDraining, StateMaintenance, StateDown},
+}
+
+// CanTransitTo reports whether node is allowed to move from x to the given state.
+func (x State) CanTransitTo(to State) bool {
+	if x == to {
+		return true
+	}
+	for _, st := range stateTransitions[x] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Routable reports whether node in this state should receive traffic.
+func (x State) Routable() bool {
+	return x == StateUp || x == StateWarning
+}
+
+// Checked reports whether node in this state is subject to health checks.
+func (x State) Checked() bool {
+	return x != StateDown && x != StateDraining && x != StateMaintenance
+}
+
+// Expirable reports whether node in this state is removed after a while.
+func (x State) Expirable() bool {
+	return x == StateDown || x == StateCritical
+}
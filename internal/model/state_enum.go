@@ -16,23 +16,47 @@ const (
 	StateDown State = iota
 	// StateUp is a State of type Up.
 	StateUp
+	// StateStarting is a State of type Starting.
+	StateStarting
+	// StatePassing is a State of type Passing.
+	StatePassing
+	// StateWarning is a State of type Warning.
+	StateWarning
+	// StateDraining is a State of type Draining.
+	StateDraining
+	// StateMaintenance is a State of type Maintenance.
+	StateMaintenance
+	// StateCritical is a State of type Critical.
+	StateCritical
 )
 
 var ErrInvalidState = errors.New("not a valid State")
 
-const _StateName = "downup"
+const _StateName = "downupstartingpassingwarningdrainingmaintenancecritical"
 
 // StateValues returns a list of the values for State
 func StateValues() []State {
 	return []State{
 		StateDown,
 		StateUp,
+		StateStarting,
+		StatePassing,
+		StateWarning,
+		StateDraining,
+		StateMaintenance,
+		StateCritical,
 	}
 }
 
 var _StateMap = map[State]string{
-	StateDown: _StateName[0:4],
-	StateUp:   _StateName[4:6],
+	StateDown:        _StateName[0:4],
+	StateUp:          _StateName[4:6],
+	StateStarting:    _StateName[6:14],
+	StatePassing:     _StateName[14:21],
+	StateWarning:     _StateName[21:28],
+	StateDraining:    _StateName[28:36],
+	StateMaintenance: _StateName[36:47],
+	StateCritical:    _StateName[47:55],
 }
 
 // String implements the Stringer interface.
@@ -51,8 +75,14 @@ func (x State) IsValid() bool {
 }
 
 var _StateValue = map[string]State{
-	_StateName[0:4]: StateDown,
-	_StateName[4:6]: StateUp,
+	_StateName[0:4]:   StateDown,
+	_StateName[4:6]:   StateUp,
+	_StateName[6:14]:  StateStarting,
+	_StateName[14:21]: StatePassing,
+	_StateName[21:28]: StateWarning,
+	_StateName[28:36]: StateDraining,
+	_StateName[36:47]: StateMaintenance,
+	_StateName[47:55]: StateCritical,
 }
 
 // ParseState attempts to convert a string to a State.
@@ -1,6 +1,7 @@
 package badger_nodes
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,34 +12,60 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	"github.com/horockey/service_discovery/internal/model"
 	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ nodes.Repository = &badgerNodes{}
 
+var tracer = otel.Tracer("github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes")
+
+var nodeKeyPrefix = []byte("node/")
+
+const removedChSize = 100
+
 type badgerNodes struct {
 	db *badger.DB
 
 	mu             sync.RWMutex
 	downNodesRmDur time.Duration
 	downedNodes    map[string]context.CancelFunc
+	removed        chan model.Node
+
+	revMu sync.Mutex
+	revCh chan struct{}
 }
 
+// New creates repo removing nodes after downNodesRmDur in expirable state.
+// Non-positive downNodesRmDur disables removal, leaving it to the caller.
 func New(
 	db *badger.DB,
 	downNodesRmDur time.Duration,
-) *badgerNodes {
-	return &badgerNodes{
+) (*badgerNodes, error) {
+	repo := &badgerNodes{
 		db:             db,
 		downNodesRmDur: downNodesRmDur,
 		downedNodes:    map[string]context.CancelFunc{},
+		removed:        make(chan model.Node, removedChSize),
+		revCh:          make(chan struct{}),
 	}
+
+	if err := repo.migrateLegacyKeys(); err != nil {
+		return nil, fmt.Errorf("migrating legacy keys: %w", err)
+	}
+
+	return repo, nil
 }
 
 func (repo *badgerNodes) GetAll(_ context.Context) ([]model.Node, error) {
 	res := []model.Node{}
 
 	err := repo.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = nodeKeyPrefix
+		it := txn.NewIterator(opts)
 		defer it.Close()
 
 		for it.Rewind(); it.Valid(); it.Next() {
@@ -62,30 +89,62 @@ func (repo *badgerNodes) GetAll(_ context.Context) ([]model.Node, error) {
 	return res, nil
 }
 
-func (repo *badgerNodes) AddOrUpdate(_ context.Context, n model.Node) error {
+func (repo *badgerNodes) AddOrUpdate(ctx context.Context, n model.Node) error {
+	_, err := repo.save(ctx, n, false)
+	return err
+}
+
+func (repo *badgerNodes) AddOrUpdateWithRevision(ctx context.Context, n model.Node) (model.Node, error) {
+	return repo.save(ctx, n, true)
+}
+
+// save stores the node, setting its Revision to the next one of the service if bump is set.
+func (repo *badgerNodes) save(ctx context.Context, n model.Node, bump bool) (model.Node, error) {
+	_, span := tracer.Start(ctx, "nodes_repo.add_or_update", trace.WithAttributes(
+		attribute.String("node.id", n.ID),
+		attribute.String("node.state", n.State.String()),
+	))
 	err := repo.db.Update(func(txn *badger.Txn) error {
+		if bump {
+			var err error
+			if n.Revision, err = bumpRevision(txn, n.ServiceName); err != nil {
+				return fmt.Errorf("bumping revision: %w", err)
+			}
+		}
+
 		data, err := json.Marshal(n)
 		if err != nil {
 			return fmt.Errorf("marshaling json: %w", err)
 		}
 
-		if err := txn.Set([]byte(n.ID), data); err != nil {
+		if err := txn.Set(nodeKey(n.ID), data); err != nil {
 			return fmt.Errorf("setting kvp to bd: %w", err)
 		}
 
 		return nil
 	})
+	tracing.End(span, err)
 	if err != nil {
-		return fmt.Errorf("updating in db: %w", err)
+		return model.Node{}, fmt.Errorf("updating in db: %w", err)
 	}
 
-	switch n.State {
-	case model.StateDown:
-		ctx, cancel := context.WithTimeout(context.Background(), repo.downNodesRmDur)
+	// Waiters are woken only after commit, so that they read the node along with revision.
+	if bump {
+		repo.notifyRevision()
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
-		repo.mu.Lock()
+	if repo.downNodesRmDur <= 0 {
+		return n, nil
+	}
+
+	cancel, scheduled := repo.downedNodes[n.ID]
+	switch {
+	case n.State.Expirable() && !scheduled:
+		ctx, cancel := context.WithTimeout(context.Background(), repo.downNodesRmDur)
 		repo.downedNodes[n.ID] = cancel
-		defer repo.mu.Unlock()
 
 		go func(id string) {
 			<-ctx.Done()
@@ -93,63 +152,128 @@ func (repo *badgerNodes) AddOrUpdate(_ context.Context, n model.Node) error {
 			case errors.Is(ctx.Err(), context.Canceled):
 				return
 			case errors.Is(ctx.Err(), context.DeadlineExceeded):
-				_ = repo.remove(id)
+				repo.mu.Lock()
+				delete(repo.downedNodes, id)
+				repo.mu.Unlock()
+				if n, err := repo.Remove(context.Background(), id); err == nil {
+					repo.removed <- n
+				}
 			}
 		}(n.ID)
-	case model.StateUp:
-		repo.mu.Lock()
-		cancel, found := repo.downedNodes[n.ID]
-		if !found {
-			repo.mu.Unlock()
-			break
-		}
+	case !n.State.Expirable() && scheduled:
 		cancel()
 		delete(repo.downedNodes, n.ID)
-		repo.mu.Unlock()
 	}
 
-	return nil
+	return n, nil
 }
 
-func (repo *badgerNodes) SetDown(ctx context.Context, id string) error {
+func (repo *badgerNodes) Get(_ context.Context, id string) (model.Node, error) {
 	n := model.Node{}
 	if err := repo.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(id))
-		if err != nil {
-			return fmt.Errorf("reading key: %w", err)
-		}
+		var err error
+		n, err = get(txn, id)
+		return err
+	}); err != nil {
+		return model.Node{}, fmt.Errorf("viewing db: %w", err)
+	}
 
-		var data []byte
-		_ = item.Value(func(val []byte) error { data = val; return nil })
+	return n, nil
+}
 
-		if err := json.Unmarshal(data, &n); err != nil {
-			return fmt.Errorf("unmarshalling data json: %w", err)
+func get(txn *badger.Txn, id string) (model.Node, error) {
+	item, err := txn.Get(nodeKey(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return model.Node{}, nodes.ErrNotFound
 		}
-
-		return nil
-	}); err != nil {
-		return fmt.Errorf("checking key exsistance in db")
+		return model.Node{}, fmt.Errorf("reading key: %w", err)
 	}
 
-	n.State = model.StateDown
+	var data []byte
+	_ = item.Value(func(val []byte) error { data = val; return nil })
 
-	if err := repo.AddOrUpdate(ctx, n); err != nil {
-		return fmt.Errorf("updating state to down: %w", err)
+	n := model.Node{}
+	if err := json.Unmarshal(data, &n); err != nil {
+		return model.Node{}, fmt.Errorf("unmarshalling data json: %w", err)
 	}
 
-	return nil
+	return n, nil
 }
 
-func (repo *badgerNodes) remove(id string) error {
+// Remove deletes node and bumps revision of its service,
+// as removal changes service membership.
+func (repo *badgerNodes) Remove(_ context.Context, id string) (model.Node, error) {
+	n := model.Node{}
 	err := repo.db.Update(func(txn *badger.Txn) error {
-		if err := txn.Delete([]byte(id)); err != nil {
+		var err error
+		if n, err = get(txn, id); err != nil {
+			return fmt.Errorf("getting node: %w", err)
+		}
+
+		if err := txn.Delete(nodeKey(id)); err != nil {
 			return fmt.Errorf("removing kvp: %w", err)
 		}
+
+		if n.Revision, err = bumpRevision(txn, n.ServiceName); err != nil {
+			return fmt.Errorf("bumping revision: %w", err)
+		}
+		n.ChangedAt = time.Now()
+
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("removing from bd: %w", err)
+		return model.Node{}, fmt.Errorf("removing from bd: %w", err)
+	}
+
+	repo.notifyRevision()
+	return n, nil
+}
+
+func (repo *badgerNodes) Removed() <-chan model.Node {
+	return repo.removed
+}
+
+// migrateLegacyKeys moves nodes stored under bare ID keys,
+// as was done before keys got prefixes, to prefixed keys.
+func (repo *badgerNodes) migrateLegacyKeys() error {
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		legacy := map[string][]byte{}
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if bytes.ContainsRune(key, '/') {
+				continue
+			}
+
+			data, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("reading value: %w", err)
+			}
+			legacy[string(key)] = data
+		}
+		it.Close()
+
+		for id, data := range legacy {
+			if err := txn.Set(nodeKey(id), data); err != nil {
+				return fmt.Errorf("setting kvp to bd: %w", err)
+			}
+			if err := txn.Delete([]byte(id)); err != nil {
+				return fmt.Errorf("removing kvp: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating in db: %w", err)
 	}
 
 	return nil
 }
+
+func nodeKey(id string) []byte {
+	return append(bytes.Clone(nodeKeyPrefix), id...)
+}
@@ -0,0 +1,85 @@
+package badger_nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	legacy := model.Node{ID: "node1_id", ServiceName: "fooBarService", State: model.StateUp}
+	require.NoError(t, db.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(legacy)
+		require.NoError(t, err)
+		return txn.Set([]byte(legacy.ID), data)
+	}))
+
+	repo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+
+	n, err := repo.Get(ctx, legacy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, legacy.State, n.State)
+
+	require.NoError(t, repo.AddOrUpdate(ctx, model.Node{ID: "node2_id", ServiceName: "fooBarService", State: model.StateStarting}))
+
+	all, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	node2 := model.Node{ID: "node2_id", ServiceName: "fooBarService", State: model.StateUp}
+	for expected := range uint64(3) {
+		n, err := repo.AddOrUpdateWithRevision(ctx, node2)
+		require.NoError(t, err)
+		assert.Equal(t, expected+1, n.Revision)
+	}
+	n, err = repo.AddOrUpdateWithRevision(ctx, model.Node{ID: "node3_id", ServiceName: "otherService", State: model.StateUp})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), n.Revision)
+
+	n, err = repo.Get(ctx, node2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), n.Revision)
+
+	all, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	rev, err := repo.Revision(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), rev)
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	rev, err = repo.WaitRevision(waitCtx, "fooBarService", 3)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, uint64(3), rev)
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		node2.State = model.StateCritical
+		_, _ = repo.AddOrUpdateWithRevision(ctx, node2)
+	}()
+	rev, err = repo.WaitRevision(ctx, "fooBarService", 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), rev)
+
+	// Woken waiter reads the node changed along with revision.
+	n, err = repo.Get(ctx, node2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateCritical, n.State)
+	assert.Equal(t, rev, n.Revision)
+}
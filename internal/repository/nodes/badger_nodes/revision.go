@@ -0,0 +1,116 @@
+package badger_nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	revisionKeyPrefix = []byte("revision/")
+	globalRevisionKey = []byte("global_revision/")
+)
+
+func (repo *badgerNodes) Revision(_ context.Context, serviceName string) (uint64, error) {
+	var rev uint64
+	err := repo.db.View(func(txn *badger.Txn) error {
+		var err error
+		rev, err = readRevision(txn, revisionKey(serviceName))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("viewing db: %w", err)
+	}
+
+	return rev, nil
+}
+
+func (repo *badgerNodes) WaitRevision(ctx context.Context, serviceName string, index uint64) (uint64, error) {
+	for {
+		// Channel is taken before reading revision,
+		// so that change made in between is not missed.
+		repo.revMu.Lock()
+		ch := repo.revCh
+		repo.revMu.Unlock()
+
+		rev, err := repo.Revision(ctx, serviceName)
+		if err != nil {
+			return 0, fmt.Errorf("getting revision: %w", err)
+		}
+		if rev > index {
+			return rev, nil
+		}
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return rev, fmt.Errorf("running context: %w", ctx.Err())
+		}
+	}
+}
+
+func (repo *badgerNodes) notifyRevision() {
+	repo.revMu.Lock()
+	defer repo.revMu.Unlock()
+
+	close(repo.revCh)
+	repo.revCh = make(chan struct{})
+}
+
+// bumpRevision increments revisions of the service and the global one,
+// returning the service revision.
+func bumpRevision(txn *badger.Txn, serviceName string) (uint64, error) {
+	keys := [][]byte{globalRevisionKey}
+	if serviceName != "" {
+		keys = append(keys, revisionKey(serviceName))
+	}
+
+	var serviceRev uint64
+	for _, key := range keys {
+		rev, err := readRevision(txn, key)
+		if err != nil {
+			return 0, err
+		}
+
+		rev++
+		if err := txn.Set(key, binary.BigEndian.AppendUint64(nil, rev)); err != nil {
+			return 0, fmt.Errorf("setting kvp to bd: %w", err)
+		}
+		serviceRev = rev
+	}
+
+	return serviceRev, nil
+}
+
+func readRevision(txn *badger.Txn, key []byte) (uint64, error) {
+	item, err := txn.Get(key)
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("reading key: %w", err)
+	}
+
+	var rev uint64
+	if err := item.Value(func(val []byte) error {
+		rev = binary.BigEndian.Uint64(val)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("reading value: %w", err)
+	}
+
+	return rev, nil
+}
+
+// revisionKey returns key of the service revision,
+// or of the global one for empty serviceName.
+func revisionKey(serviceName string) []byte {
+	if serviceName == "" {
+		return globalRevisionKey
+	}
+	return append(bytes.Clone(revisionKeyPrefix), serviceName...)
+}
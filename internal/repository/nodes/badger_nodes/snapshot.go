@@ -0,0 +1,99 @@
+package badger_nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// snapshotPrefixes are prefixes of all keys owned by repo.
+var snapshotPrefixes = [][]byte{nodeKeyPrefix, revisionKeyPrefix, globalRevisionKey}
+
+type snapshotEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// Snapshot writes nodes and revisions to w, to be loaded with Restore.
+func (repo *badgerNodes) Snapshot(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	err := repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for _, prefix := range snapshotPrefixes {
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				val, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return fmt.Errorf("reading value: %w", err)
+				}
+
+				if err := enc.Encode(snapshotEntry{Key: it.Item().KeyCopy(nil), Value: val}); err != nil {
+					return fmt.Errorf("encoding entry: %w", err)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("viewing db: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces nodes and revisions with ones written by Snapshot.
+// Expiry of restored nodes is not scheduled.
+func (repo *badgerNodes) Restore(r io.Reader) error {
+	if err := repo.Reset(); err != nil {
+		return fmt.Errorf("resetting repo: %w", err)
+	}
+
+	wb := repo.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	dec := json.NewDecoder(r)
+	for {
+		e := snapshotEntry{}
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decoding entry: %w", err)
+		}
+
+		if err := wb.Set(e.Key, e.Value); err != nil {
+			return fmt.Errorf("setting kvp to batch: %w", err)
+		}
+	}
+
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("flushing batch: %w", err)
+	}
+
+	repo.notifyRevision()
+	return nil
+}
+
+// Reset removes all nodes and revisions.
+func (repo *badgerNodes) Reset() error {
+	repo.mu.Lock()
+	for id, cancel := range repo.downedNodes {
+		cancel()
+		delete(repo.downedNodes, id)
+	}
+	repo.mu.Unlock()
+
+	if err := repo.db.DropPrefix(snapshotPrefixes...); err != nil {
+		return fmt.Errorf("dropping keys: %w", err)
+	}
+
+	repo.notifyRevision()
+	return nil
+}
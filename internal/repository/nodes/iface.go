@@ -2,12 +2,27 @@ package nodes
 
 import (
 	"context"
+	"errors"
 
 	"github.com/horockey/service_discovery/internal/model"
 )
 
+var ErrNotFound = errors.New("node not found")
+
 type Repository interface {
 	GetAll(ctx context.Context) ([]model.Node, error)
+	Get(ctx context.Context, id string) (model.Node, error)
 	AddOrUpdate(context.Context, model.Node) error
-	SetDown(ctx context.Context, id string) error
+	// Removed emits expired nodes after their removal,
+	// with Revision set to the service revision of removal.
+	Removed() <-chan model.Node
+	// AddOrUpdateWithRevision saves node with Revision set to the next revision
+	// of its service, returning the saved node. Global revision is incremented along with it.
+	// Node and revision are written at once, so revision waiters never see the revision before the node.
+	AddOrUpdateWithRevision(ctx context.Context, n model.Node) (model.Node, error)
+	// Revision returns revision of the service, or the global one for empty serviceName.
+	Revision(ctx context.Context, serviceName string) (uint64, error)
+	// WaitRevision blocks until revision gets greater than index or ctx is done.
+	// Last known revision is returned in both cases.
+	WaitRevision(ctx context.Context, serviceName string, index uint64) (uint64, error)
 }
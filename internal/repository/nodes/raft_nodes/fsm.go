@@ -0,0 +1,201 @@
+package raft_nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/hashicorp/raft"
+	"github.com/horockey/service_discovery/internal/cluster/raft_cluster"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+)
+
+var _ raft_cluster.ReplayAware = &fsm{}
+
+type op string
+
+const (
+	opAddOrUpdate             op = "add_or_update"
+	opAddOrUpdateWithRevision op = "add_or_update_with_revision"
+	opRemove                  op = "remove"
+
+	opOutboxAdd               op = "outbox_add"
+	opOutboxUpdate            op = "outbox_update"
+	opOutboxRemove            op = "outbox_remove"
+	opOutboxMoveToDeadLetters op = "outbox_move_to_dead_letters"
+)
+
+// LocalRepo is repo of the replica, which committed changes are applied to.
+type LocalRepo interface {
+	nodes.Repository
+	Remove(ctx context.Context, id string) (model.Node, error)
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+	Reset() error
+}
+
+// LocalOutbox is outbox of the replica, which committed changes are applied to.
+// Seq of added deliveries is to depend only on the state, so that it matches between replicas.
+type LocalOutbox interface {
+	outbox.Repository
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+	Reset() error
+}
+
+type command struct {
+	Op         op
+	Node       model.Node       `json:",omitzero"`
+	ID         string           `json:",omitempty"`
+	Deliveries []model.Delivery `json:",omitempty"`
+	Delivery   model.Delivery   `json:",omitzero"`
+	Seq        uint64           `json:",omitempty"`
+}
+
+type result struct {
+	node model.Node
+	err  error
+}
+
+type fsm struct {
+	local   LocalRepo
+	outbox  LocalOutbox
+	removed chan model.Node
+	// replayIndex is index of the last entry replayed from the log on start.
+	replayIndex atomic.Uint64
+}
+
+// NewFSM creates state machine over local repo and outbox.
+// Both are reset, as their state is restored by raft from snapshot and log.
+func NewFSM(local LocalRepo, outbox LocalOutbox) (*fsm, error) {
+	if err := local.Reset(); err != nil {
+		return nil, fmt.Errorf("resetting local repo: %w", err)
+	}
+	if err := outbox.Reset(); err != nil {
+		return nil, fmt.Errorf("resetting local outbox: %w", err)
+	}
+
+	return &fsm{
+		local:   local,
+		outbox:  outbox,
+		removed: make(chan model.Node, removedChSize),
+	}, nil
+}
+
+// SetReplayIndex is called by cluster before applying any entries.
+func (f *fsm) SetReplayIndex(index uint64) {
+	f.replayIndex.Store(index)
+}
+
+func (f *fsm) Apply(l *raft.Log) any {
+	cmd := command{}
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		return result{err: fmt.Errorf("unmarshalling command json: %w", err)}
+	}
+
+	ctx := context.Background()
+	res := result{}
+	switch cmd.Op {
+	case opAddOrUpdate:
+		res.err = f.local.AddOrUpdate(ctx, cmd.Node)
+	case opAddOrUpdateWithRevision:
+		res.node, res.err = f.local.AddOrUpdateWithRevision(ctx, cmd.Node)
+	case opRemove:
+		res.node, res.err = f.local.Remove(ctx, cmd.ID)
+		// Removal is emitted on every replica, as it is the only way for them to know about it.
+		// Replayed removals happened before start, so nobody waits for them.
+		if res.err == nil && l.Index > f.replayIndex.Load() {
+			// Apply must not block, as it holds up the whole replica.
+			// Removal is lost if consumer lags, yet state read from repo is still correct.
+			select {
+			case f.removed <- res.node:
+			default:
+			}
+		}
+	case opOutboxAdd:
+		res.err = f.outbox.Add(ctx, cmd.Deliveries)
+	case opOutboxUpdate:
+		res.err = f.outbox.Update(ctx, cmd.Delivery)
+	case opOutboxRemove:
+		res.err = f.outbox.Remove(ctx, cmd.Seq)
+	case opOutboxMoveToDeadLetters:
+		res.err = f.outbox.MoveToDeadLetters(ctx, cmd.Delivery)
+	default:
+		res.err = fmt.Errorf("unknown command op: %s", cmd.Op)
+	}
+
+	return res
+}
+
+// Snapshot copies state right away, as it is persisted concurrently with Apply.
+// Snapshots of local repo and outbox follow each other, prefixed with their length.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	nodesBuf := bytes.Buffer{}
+	if err := f.local.Snapshot(&nodesBuf); err != nil {
+		return nil, fmt.Errorf("making snapshot of local repo: %w", err)
+	}
+
+	outboxBuf := bytes.Buffer{}
+	if err := f.outbox.Snapshot(&outboxBuf); err != nil {
+		return nil, fmt.Errorf("making snapshot of local outbox: %w", err)
+	}
+
+	data := []byte{}
+	for _, part := range [][]byte{nodesBuf.Bytes(), outboxBuf.Bytes()} {
+		data = binary.BigEndian.AppendUint64(data, uint64(len(part)))
+		data = append(data, part...)
+	}
+
+	return fsmSnapshot(data), nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	nodesPart, err := readPart(rc)
+	if err != nil {
+		return fmt.Errorf("reading local repo snapshot: %w", err)
+	}
+	if err := f.local.Restore(nodesPart); err != nil {
+		return fmt.Errorf("restoring local repo: %w", err)
+	}
+
+	outboxPart, err := readPart(rc)
+	if err != nil {
+		return fmt.Errorf("reading local outbox snapshot: %w", err)
+	}
+	if err := f.outbox.Restore(outboxPart); err != nil {
+		return fmt.Errorf("restoring local outbox: %w", err)
+	}
+
+	return nil
+}
+
+// readPart returns reader of the next length prefixed part of snapshot.
+func readPart(r io.Reader) (io.Reader, error) {
+	var size uint64
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("reading size: %w", err)
+	}
+
+	return io.LimitReader(r, int64(size)), nil
+}
+
+type fsmSnapshot []byte
+
+func (s fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s); err != nil {
+		_ = sink.Cancel()
+		return fmt.Errorf("writing to sink: %w", err)
+	}
+
+	return sink.Close()
+}
+
+func (fsmSnapshot) Release() {}
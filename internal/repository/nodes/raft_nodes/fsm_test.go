@@ -0,0 +1,56 @@
+package raft_nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/hashicorp/raft"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/raft_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSMRemoved(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	local, err := badger_nodes.New(db, 0)
+	require.NoError(t, err)
+	localOutbox, err := badger_outbox.New(db)
+	require.NoError(t, err)
+	fsm, err := raft_nodes.NewFSM(local, localOutbox)
+	require.NoError(t, err)
+	repo := raft_nodes.New(fsm, nil, 0)
+
+	const replayed = 10
+	fsm.SetReplayIndex(replayed)
+
+	ctx := context.TODO()
+	index := uint64(0)
+	remove := func() {
+		require.NoError(t, local.AddOrUpdate(ctx, model.Node{ID: "node_id", ServiceName: "foo"}))
+
+		data, err := json.Marshal(map[string]string{"Op": "remove", "ID": "node_id"})
+		require.NoError(t, err)
+		index++
+		fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+
+	// Only removals applied after replay are emitted.
+	for range replayed + 5 {
+		remove()
+	}
+	assert.Len(t, repo.Removed(), 5)
+
+	// Apply is not blocked, though nobody reads removals.
+	for range cap(repo.Removed()) {
+		remove()
+	}
+	assert.Len(t, repo.Removed(), cap(repo.Removed()))
+}
@@ -0,0 +1,65 @@
+package raft_nodes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+)
+
+var _ outbox.Repository = &raftOutbox{}
+
+// raftOutbox reads local outbox of the replica,
+// and makes changes through the log, so that a new leader continues delivery.
+type raftOutbox struct {
+	fsm     *fsm
+	applier Applier
+}
+
+func NewOutbox(fsm *fsm, applier Applier) *raftOutbox {
+	return &raftOutbox{
+		fsm:     fsm,
+		applier: applier,
+	}
+}
+
+func (repo *raftOutbox) Add(ctx context.Context, ds []model.Delivery) error {
+	if _, err := apply(ctx, repo.applier, command{Op: opOutboxAdd, Deliveries: ds}); err != nil {
+		return fmt.Errorf("applying command: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *raftOutbox) GetAll(ctx context.Context) ([]model.Delivery, error) {
+	return repo.fsm.outbox.GetAll(ctx)
+}
+
+func (repo *raftOutbox) Update(ctx context.Context, d model.Delivery) error {
+	if _, err := apply(ctx, repo.applier, command{Op: opOutboxUpdate, Delivery: d}); err != nil {
+		return fmt.Errorf("applying command: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *raftOutbox) Remove(ctx context.Context, seq uint64) error {
+	if _, err := apply(ctx, repo.applier, command{Op: opOutboxRemove, Seq: seq}); err != nil {
+		return fmt.Errorf("applying command: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *raftOutbox) MoveToDeadLetters(ctx context.Context, d model.Delivery) error {
+	if _, err := apply(ctx, repo.applier, command{Op: opOutboxMoveToDeadLetters, Delivery: d}); err != nil {
+		return fmt.Errorf("applying command: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *raftOutbox) GetDeadLetters(ctx context.Context) ([]model.Delivery, error) {
+	return repo.fsm.outbox.GetDeadLetters(ctx)
+}
@@ -0,0 +1,179 @@
+package raft_nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+)
+
+var _ nodes.Repository = &raftNodes{}
+
+const removedChSize = 100
+
+type Applier interface {
+	// Apply commits data to the log and returns response of fsm applying it.
+	Apply(ctx context.Context, data []byte) (any, error)
+}
+
+// raftNodes reads local state of the replica,
+// and makes changes through the log, which only succeeds on the leader.
+type raftNodes struct {
+	fsm     *fsm
+	applier Applier
+
+	mu             sync.Mutex
+	downNodesRmDur time.Duration
+	downedNodes    map[string]context.CancelFunc
+	// leaderCtx is set while Start runs, as nodes are only removed by the leader.
+	leaderCtx context.Context
+}
+
+func New(
+	fsm *fsm,
+	applier Applier,
+	downNodesRmDur time.Duration,
+) *raftNodes {
+	return &raftNodes{
+		fsm:            fsm,
+		applier:        applier,
+		downNodesRmDur: downNodesRmDur,
+		downedNodes:    map[string]context.CancelFunc{},
+	}
+}
+
+// Start schedules removal of expirable nodes until ctx is done.
+// It is to be run on the leader only.
+func (repo *raftNodes) Start(ctx context.Context) error {
+	all, err := repo.fsm.local.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes from local repo: %w", err)
+	}
+
+	repo.mu.Lock()
+	repo.leaderCtx = ctx
+	for _, n := range all {
+		repo.schedule(n)
+	}
+	repo.mu.Unlock()
+
+	<-ctx.Done()
+
+	repo.mu.Lock()
+	repo.leaderCtx = nil
+	for id, cancel := range repo.downedNodes {
+		cancel()
+		delete(repo.downedNodes, id)
+	}
+	repo.mu.Unlock()
+
+	return fmt.Errorf("running context: %w", ctx.Err())
+}
+
+func (repo *raftNodes) GetAll(ctx context.Context) ([]model.Node, error) {
+	return repo.fsm.local.GetAll(ctx)
+}
+
+func (repo *raftNodes) Get(ctx context.Context, id string) (model.Node, error) {
+	return repo.fsm.local.Get(ctx, id)
+}
+
+func (repo *raftNodes) AddOrUpdate(ctx context.Context, n model.Node) error {
+	if _, err := repo.apply(ctx, command{Op: opAddOrUpdate, Node: n}); err != nil {
+		return fmt.Errorf("applying command: %w", err)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.schedule(n)
+
+	return nil
+}
+
+func (repo *raftNodes) Removed() <-chan model.Node {
+	return repo.fsm.removed
+}
+
+func (repo *raftNodes) AddOrUpdateWithRevision(ctx context.Context, n model.Node) (model.Node, error) {
+	res, err := repo.apply(ctx, command{Op: opAddOrUpdateWithRevision, Node: n})
+	if err != nil {
+		return model.Node{}, fmt.Errorf("applying command: %w", err)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.schedule(res.node)
+
+	return res.node, nil
+}
+
+func (repo *raftNodes) Revision(ctx context.Context, serviceName string) (uint64, error) {
+	return repo.fsm.local.Revision(ctx, serviceName)
+}
+
+func (repo *raftNodes) WaitRevision(ctx context.Context, serviceName string, index uint64) (uint64, error) {
+	return repo.fsm.local.WaitRevision(ctx, serviceName, index)
+}
+
+func (repo *raftNodes) apply(ctx context.Context, cmd command) (result, error) {
+	return apply(ctx, repo.applier, cmd)
+}
+
+// apply commits cmd to the log and returns result of applying it to the leader fsm.
+func apply(ctx context.Context, applier Applier, cmd command) (result, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return result{}, fmt.Errorf("marshaling json: %w", err)
+	}
+
+	resp, err := applier.Apply(ctx, data)
+	if err != nil {
+		return result{}, fmt.Errorf("applying to log: %w", err)
+	}
+
+	res, ok := resp.(result)
+	if !ok {
+		return result{}, fmt.Errorf("unexpected fsm response: %v", resp)
+	}
+	if res.err != nil {
+		return result{}, res.err
+	}
+
+	return res, nil
+}
+
+// schedule starts or cancels removal of the node, if replica is the leader.
+// Must be called with repo.mu held.
+func (repo *raftNodes) schedule(n model.Node) {
+	if repo.leaderCtx == nil {
+		return
+	}
+
+	cancel, scheduled := repo.downedNodes[n.ID]
+	switch {
+	case n.State.Expirable() && !scheduled:
+		ctx, cancel := context.WithTimeout(repo.leaderCtx, repo.downNodesRmDur)
+		repo.downedNodes[n.ID] = cancel
+
+		go func(id string) {
+			<-ctx.Done()
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+
+			repo.mu.Lock()
+			delete(repo.downedNodes, id)
+			repo.mu.Unlock()
+
+			_, _ = repo.apply(context.WithoutCancel(ctx), command{Op: opRemove, ID: id})
+		}(n.ID)
+	case !n.State.Expirable() && scheduled:
+		cancel()
+		delete(repo.downedNodes, n.ID)
+	}
+}
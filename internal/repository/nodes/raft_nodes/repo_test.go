@@ -0,0 +1,228 @@
+package raft_nodes_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/cluster"
+	"github.com/horockey/service_discovery/internal/cluster/raft_cluster"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/raft_nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+	"github.com/horockey/service_discovery/internal/repository/outbox/badger_outbox"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	replicasNum    = 3
+	downNodesRmDur = time.Millisecond * 300
+	electionWait   = time.Second * 10
+)
+
+var logger = zerolog.New(zerolog.ConsoleWriter{
+	Out:        os.Stdout,
+	TimeFormat: time.RFC3339,
+}).With().Timestamp().Logger()
+
+type replica struct {
+	cluster interface {
+		cluster.Cluster
+		Close() error
+	}
+	repo   nodes.Repository
+	outbox outbox.Repository
+	closed bool
+}
+
+func TestCluster(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*30)
+	defer cancel()
+
+	peers := make([]cluster.Peer, replicasNum)
+	httpLis := make([]net.Listener, replicasNum)
+	for idx := range peers {
+		raftLis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		require.NoError(t, raftLis.Close())
+
+		httpLis[idx], err = net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		peers[idx] = cluster.Peer{
+			ID:       string(rune('a' + idx)),
+			RaftAddr: raftLis.Addr().String(),
+			HTTPAddr: httpLis[idx].Addr().String(),
+		}
+	}
+
+	replicas := make([]*replica, replicasNum)
+	for idx, peer := range peers {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		local, err := badger_nodes.New(db, 0)
+		require.NoError(t, err)
+		localOutbox, err := badger_outbox.New(db)
+		require.NoError(t, err)
+		fsm, err := raft_nodes.NewFSM(local, localOutbox)
+		require.NoError(t, err)
+
+		cl, err := raft_cluster.New(
+			raft_cluster.Config{
+				ID:       peer.ID,
+				BindAddr: peer.RaftAddr,
+				Dir:      t.TempDir(),
+				Peers:    peers,
+			},
+			fsm,
+			"",
+			logger,
+		)
+		require.NoError(t, err)
+
+		serv := &http.Server{Handler: cl.Handler()}
+		go func() { _ = serv.Serve(httpLis[idx]) }()
+		t.Cleanup(func() { _ = serv.Close() })
+
+		repo := raft_nodes.New(fsm, cl, downNodesRmDur)
+		go func() { _ = cl.RunLeader(ctx, repo.Start) }()
+
+		replicas[idx] = &replica{cluster: cl, repo: repo, outbox: raft_nodes.NewOutbox(fsm, cl)}
+	}
+	t.Cleanup(func() {
+		for _, r := range replicas {
+			if !r.closed {
+				_ = r.cluster.Close()
+			}
+		}
+	})
+
+	leader := waitLeader(t, replicas)
+	followers := lo.Without(replicas, leader)
+	waitMembers(t, replicas, replicasNum)
+
+	node := model.Node{ID: "node1_id", ServiceName: "fooBarService", State: model.StateUp}
+	node, err := leader.repo.AddOrUpdateWithRevision(ctx, node)
+	require.NoError(t, err)
+	rev := node.Revision
+	assert.Equal(t, uint64(1), rev)
+
+	err = followers[0].repo.AddOrUpdate(ctx, node)
+	assert.ErrorIs(t, err, cluster.ErrNotLeader)
+
+	for _, f := range followers {
+		require.NoError(t, f.cluster.Sync(ctx))
+		n, err := f.repo.Get(ctx, node.ID)
+		require.NoError(t, err)
+		assert.Equal(t, node.State, n.State)
+
+		fRev, err := f.repo.Revision(ctx, node.ServiceName)
+		require.NoError(t, err)
+		assert.Equal(t, rev, fRev)
+	}
+
+	// Outbox is replicated with the same seqs, so a new leader continues delivery.
+	require.NoError(t, leader.outbox.Add(ctx, []model.Delivery{{ReceiverID: "r1"}, {ReceiverID: "r2"}}))
+	require.NoError(t, leader.outbox.Remove(ctx, 1))
+	assert.ErrorIs(t, followers[0].outbox.Remove(ctx, 2), cluster.ErrNotLeader)
+	for _, f := range followers {
+		require.NoError(t, f.cluster.Sync(ctx))
+		ds, err := f.outbox.GetAll(ctx)
+		require.NoError(t, err)
+		require.Len(t, ds, 1)
+		assert.Equal(t, uint64(2), ds[0].Seq)
+		assert.Equal(t, "r2", ds[0].ReceiverID)
+	}
+
+	// Expiry is done by the leader, and removal is seen by every replica.
+	node.State = model.StateDown
+	require.NoError(t, leader.repo.AddOrUpdate(ctx, node))
+	for _, r := range replicas {
+		select {
+		case n := <-r.repo.Removed():
+			assert.Equal(t, node.ID, n.ID)
+			assert.Greater(t, n.Revision, rev)
+		case <-ctx.Done():
+			require.FailNow(t, "node is not removed")
+		}
+	}
+
+	// Health updates made by followers are applied by the leader.
+	upd := model.Node{ID: "node1_id", State: model.StateCritical}
+	require.NoError(t, followers[0].cluster.ForwardUpd(ctx, upd))
+	select {
+	case fwd := <-leader.cluster.ForwardedUpds():
+		assert.Equal(t, upd.ID, fwd.ID)
+		assert.Equal(t, upd.State, fwd.State)
+	case <-ctx.Done():
+		require.FailNow(t, "upd is not forwarded")
+	}
+
+	require.NoError(t, leader.cluster.Close())
+	leader.closed = true
+
+	leader = waitLeader(t, followers)
+	// Checks of the closed replica are taken over by the rest.
+	waitMembers(t, followers, replicasNum-1)
+
+	node = model.Node{ID: "node2_id", ServiceName: "fooBarService", State: model.StateUp}
+	require.NoError(t, leader.repo.AddOrUpdate(ctx, node))
+
+	follower := lo.Without(followers, leader)[0]
+	require.NoError(t, follower.cluster.Sync(ctx))
+	all, err := follower.repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, node.ID, all[0].ID)
+}
+
+func waitLeader(t *testing.T, replicas []*replica) *replica {
+	t.Helper()
+
+	var leader *replica
+	require.Eventually(t, func() bool {
+		for _, r := range replicas {
+			if r.cluster.IsLeader() {
+				leader = r
+				return true
+			}
+		}
+		return false
+	}, electionWait, time.Millisecond*50)
+
+	// Followers are to know the new leader too, to forward requests to it.
+	require.Eventually(t, func() bool {
+		for _, r := range replicas {
+			if _, err := r.cluster.Leader(); err != nil {
+				return false
+			}
+		}
+		return true
+	}, electionWait, time.Millisecond*50)
+
+	return leader
+}
+
+func waitMembers(t *testing.T, replicas []*replica, num int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		for _, r := range replicas {
+			if len(r.cluster.Members()) != num {
+				return false
+			}
+		}
+		return true
+	}, electionWait, time.Millisecond*50)
+}
@@ -0,0 +1,188 @@
+package badger_outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+)
+
+var _ outbox.Repository = &badgerOutbox{}
+
+var (
+	pendingKeyPrefix    = []byte("outbox/")
+	deadLetterKeyPrefix = []byte("dead_letter/")
+)
+
+type badgerOutbox struct {
+	db *badger.DB
+
+	mu      sync.Mutex
+	lastSeq uint64
+}
+
+func New(db *badger.DB) (*badgerOutbox, error) {
+	repo := &badgerOutbox{
+		db: db,
+	}
+
+	for _, prefix := range [][]byte{pendingKeyPrefix, deadLetterKeyPrefix} {
+		seq, err := repo.maxSeq(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("getting max seq for %s: %w", prefix, err)
+		}
+		repo.lastSeq = max(repo.lastSeq, seq)
+	}
+
+	return repo, nil
+}
+
+func (repo *badgerOutbox) Add(_ context.Context, ds []model.Delivery) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	seq := repo.lastSeq
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		for _, d := range ds {
+			seq++
+			d.Seq = seq
+			if err := set(txn, pendingKeyPrefix, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating in db: %w", err)
+	}
+
+	repo.lastSeq = seq
+	return nil
+}
+
+func (repo *badgerOutbox) GetAll(_ context.Context) ([]model.Delivery, error) {
+	return repo.list(pendingKeyPrefix)
+}
+
+func (repo *badgerOutbox) Update(_ context.Context, d model.Delivery) error {
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		return set(txn, pendingKeyPrefix, d)
+	})
+	if err != nil {
+		return fmt.Errorf("updating in db: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *badgerOutbox) Remove(_ context.Context, seq uint64) error {
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(key(pendingKeyPrefix, seq)); err != nil {
+			return fmt.Errorf("removing kvp: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating in db: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *badgerOutbox) MoveToDeadLetters(_ context.Context, d model.Delivery) error {
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(key(pendingKeyPrefix, d.Seq)); err != nil {
+			return fmt.Errorf("removing kvp: %w", err)
+		}
+		return set(txn, deadLetterKeyPrefix, d)
+	})
+	if err != nil {
+		return fmt.Errorf("updating in db: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *badgerOutbox) GetDeadLetters(_ context.Context) ([]model.Delivery, error) {
+	return repo.list(deadLetterKeyPrefix)
+}
+
+func (repo *badgerOutbox) list(prefix []byte) ([]model.Delivery, error) {
+	res := []model.Delivery{}
+
+	err := repo.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var data []byte
+			_ = it.Item().Value(func(val []byte) error { data = val; return nil })
+
+			d := model.Delivery{}
+			if err := json.Unmarshal(data, &d); err != nil {
+				return fmt.Errorf("unmarshalling data json: %w", err)
+			}
+
+			res = append(res, d)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("viewing db: %w", err)
+	}
+
+	return res, nil
+}
+
+func (repo *badgerOutbox) maxSeq(prefix []byte) (uint64, error) {
+	var seq uint64
+
+	err := repo.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.Reverse = true
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Reverse iteration starts from the key less or equal to the sought one.
+		it.Seek(append(bytes.Clone(prefix), 0xff))
+		if it.Valid() {
+			seq = binary.BigEndian.Uint64(it.Item().Key()[len(prefix):])
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("viewing db: %w", err)
+	}
+
+	return seq, nil
+}
+
+func set(txn *badger.Txn, prefix []byte, d model.Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+
+	if err := txn.Set(key(prefix, d.Seq), data); err != nil {
+		return fmt.Errorf("setting kvp to bd: %w", err)
+	}
+
+	return nil
+}
+
+// key is built from big endian seq, so that keys order matches seq order.
+func key(prefix []byte, seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(bytes.Clone(prefix), seq)
+}
@@ -0,0 +1,104 @@
+package badger_outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// snapshotPrefixes are prefixes of all keys owned by repo.
+var snapshotPrefixes = [][]byte{pendingKeyPrefix, deadLetterKeyPrefix}
+
+type snapshotEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// Snapshot writes pending deliveries and dead letters to w, to be loaded with Restore.
+func (repo *badgerOutbox) Snapshot(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	err := repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for _, prefix := range snapshotPrefixes {
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				val, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return fmt.Errorf("reading value: %w", err)
+				}
+
+				if err := enc.Encode(snapshotEntry{Key: it.Item().KeyCopy(nil), Value: val}); err != nil {
+					return fmt.Errorf("encoding entry: %w", err)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("viewing db: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces deliveries with ones written by Snapshot.
+// Seq assignment continues from the restored ones.
+func (repo *badgerOutbox) Restore(r io.Reader) error {
+	if err := repo.Reset(); err != nil {
+		return fmt.Errorf("resetting repo: %w", err)
+	}
+
+	wb := repo.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	dec := json.NewDecoder(r)
+	for {
+		e := snapshotEntry{}
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decoding entry: %w", err)
+		}
+
+		if err := wb.Set(e.Key, e.Value); err != nil {
+			return fmt.Errorf("setting kvp to batch: %w", err)
+		}
+	}
+
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("flushing batch: %w", err)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, prefix := range snapshotPrefixes {
+		seq, err := repo.maxSeq(prefix)
+		if err != nil {
+			return fmt.Errorf("getting max seq for %s: %w", prefix, err)
+		}
+		repo.lastSeq = max(repo.lastSeq, seq)
+	}
+
+	return nil
+}
+
+// Reset removes all deliveries and restarts seq assignment.
+func (repo *badgerOutbox) Reset() error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if err := repo.db.DropPrefix(snapshotPrefixes...); err != nil {
+		return fmt.Errorf("dropping keys: %w", err)
+	}
+
+	repo.lastSeq = 0
+	return nil
+}
@@ -0,0 +1,18 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Repository interface {
+	// Add stores deliveries assigning them increasing Seq.
+	Add(ctx context.Context, ds []model.Delivery) error
+	// GetAll returns pending deliveries ordered by Seq.
+	GetAll(ctx context.Context) ([]model.Delivery, error)
+	Update(ctx context.Context, d model.Delivery) error
+	Remove(ctx context.Context, seq uint64) error
+	MoveToDeadLetters(ctx context.Context, d model.Delivery) error
+	GetDeadLetters(ctx context.Context) ([]model.Delivery, error)
+}
@@ -0,0 +1,76 @@
+package dto
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+type Node struct {
+	ID          string
+	Hostname    string
+	ServiceName string
+	State       string
+	Damped      bool
+	Meta        map[string]string
+	Maintenance *Maintenance
+	Heartbeat   *Heartbeat
+	Revision    uint64
+	ChangedAt   time.Time
+}
+
+type Maintenance struct {
+	Reason string
+	Since  time.Time
+	Until  *time.Time
+}
+
+type Heartbeat struct {
+	At     time.Time
+	Status string
+	Note   string
+}
+
+func (n Node) ToModel(dc string) (model.Node, error) {
+	state, err := model.ParseState(n.State)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("parsing state: %w", err)
+	}
+
+	res := model.Node{
+		ID:          n.ID,
+		Hostname:    n.Hostname,
+		ServiceName: n.ServiceName,
+		State:       state,
+		Damped:      n.Damped,
+		Meta:        n.Meta,
+		Revision:    n.Revision,
+		ChangedAt:   n.ChangedAt,
+		Datacenter:  dc,
+	}
+
+	if n.Maintenance != nil {
+		res.Maintenance = &model.Maintenance{
+			Reason: n.Maintenance.Reason,
+			Since:  n.Maintenance.Since,
+		}
+		if n.Maintenance.Until != nil {
+			res.Maintenance.Until = *n.Maintenance.Until
+		}
+	}
+
+	if n.Heartbeat != nil {
+		status, err := model.ParseCheckStatus(n.Heartbeat.Status)
+		if err != nil {
+			return model.Node{}, fmt.Errorf("parsing heartbeat status: %w", err)
+		}
+		res.Heartbeat = &model.Heartbeat{
+			At:     n.Heartbeat.At,
+			Status: status,
+			Note:   n.Heartbeat.Note,
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,281 @@
+package http_remote_nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes/http_remote_nodes/dto"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var _ remote_nodes.Repository = &httpRemoteNodes{}
+
+const (
+	indexHeader = "X-Discovery-Index"
+
+	pollWait = time.Minute
+	retryIvl = time.Second * 5
+)
+
+// Peer is discovery of the remote datacenter.
+type Peer struct {
+	Datacenter string
+	URL        string
+	APIKey     string
+}
+
+type httpRemoteNodes struct {
+	peers        []Peer
+	maxStaleness time.Duration
+	logger       zerolog.Logger
+
+	mu  sync.RWMutex
+	dcs map[string]*dcState
+}
+
+type dcState struct {
+	cl     *resty.Client
+	synced bool
+	// syncedAt is the time of the last successful fetch.
+	syncedAt time.Time
+	// failing is set while remote is unreachable. Blocked poll is not failing,
+	// so idle remote does not get stale.
+	failing bool
+	nodes   []model.Node
+	rev     uint64
+	// changed is closed and replaced on every sync.
+	changed chan struct{}
+}
+
+// New creates cache of remote datacenters nodes.
+// It is kept in sync by blocking queries to remote listing, see Start.
+// Nodes of remote, which is unreachable for longer than maxStaleness since the last sync,
+// are not served. Zero maxStaleness makes them served until remote is back.
+func New(peers []Peer, maxStaleness time.Duration, logger zerolog.Logger) (*httpRemoteNodes, error) {
+	if maxStaleness < 0 {
+		return nil, fmt.Errorf("got negative max staleness: %s", maxStaleness)
+	}
+
+	dcs := map[string]*dcState{}
+	for _, p := range peers {
+		if p.Datacenter == "" {
+			return nil, errors.New("got peer with empty datacenter")
+		}
+		if p.URL == "" {
+			return nil, fmt.Errorf("got empty url of datacenter %s", p.Datacenter)
+		}
+		if _, found := dcs[p.Datacenter]; found {
+			return nil, fmt.Errorf("got duplicate datacenter %s", p.Datacenter)
+		}
+
+		dcs[p.Datacenter] = &dcState{
+			cl: resty.New().
+				SetBaseURL(p.URL).
+				SetHeader("X-Api-Key", p.APIKey).
+				SetTimeout(pollWait + time.Second*10),
+			changed: make(chan struct{}),
+		}
+	}
+
+	return &httpRemoteNodes{
+		peers:        peers,
+		maxStaleness: maxStaleness,
+		logger:       logger,
+		dcs:          dcs,
+	}, nil
+}
+
+// Start follows all remote datacenters until ctx is done.
+// Cached nodes are kept while remote is unreachable, until they get stale.
+func (rn *httpRemoteNodes) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, p := range rn.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rn.follow(ctx, p.Datacenter)
+		}()
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	return fmt.Errorf("running context: %w", ctx.Err())
+}
+
+func (rn *httpRemoteNodes) Datacenters() []string {
+	dcs := lo.Map(rn.peers, func(el Peer, _ int) string { return el.Datacenter })
+	slices.Sort(dcs)
+
+	return dcs
+}
+
+func (rn *httpRemoteNodes) GetAll(_ context.Context, dc string) ([]model.Node, uint64, error) {
+	rn.mu.RLock()
+	defer rn.mu.RUnlock()
+
+	st, found := rn.dcs[dc]
+	if !found {
+		return nil, 0, fmt.Errorf("%w: %s", remote_nodes.ErrUnknownDatacenter, dc)
+	}
+	if !st.synced {
+		return nil, 0, fmt.Errorf("%w: %s", remote_nodes.ErrNotSynced, dc)
+	}
+	if st.failing && rn.maxStaleness > 0 && time.Since(st.syncedAt) > rn.maxStaleness {
+		return nil, 0, fmt.Errorf(
+			"%w: %s is unreachable since %s",
+			remote_nodes.ErrNotSynced,
+			dc,
+			st.syncedAt.Format(time.RFC3339),
+		)
+	}
+
+	return slices.Clone(st.nodes), st.rev, nil
+}
+
+func (rn *httpRemoteNodes) WaitRevision(ctx context.Context, dc string, index uint64) (uint64, error) {
+	for {
+		rn.mu.RLock()
+		st, found := rn.dcs[dc]
+		if !found {
+			rn.mu.RUnlock()
+			return 0, fmt.Errorf("%w: %s", remote_nodes.ErrUnknownDatacenter, dc)
+		}
+		rev, changed := st.rev, st.changed
+		rn.mu.RUnlock()
+
+		if rev > index {
+			return rev, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return rev, fmt.Errorf("waiting for revision: %w", ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+func (rn *httpRemoteNodes) follow(ctx context.Context, dc string) {
+	var index uint64
+	for {
+		nodes, rev, err := rn.fetch(ctx, dc, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			rn.logger.
+				Warn().
+				Str("datacenter", dc).
+				Err(fmt.Errorf("fetching nodes: %w", err)).
+				Send()
+			rn.setFailing(dc)
+			if !sleep(ctx, retryIvl) {
+				return
+			}
+			continue
+		}
+
+		rn.set(dc, nodes, rev)
+
+		// Remote revision goes back if remote state is lost,
+		// so index follows it rather than only grows.
+		index = rev
+
+		// Zero index makes query non-blocking, so empty remote is polled.
+		if index == 0 && !sleep(ctx, retryIvl) {
+			return
+		}
+	}
+}
+
+// fetch gets all nodes of the datacenter. Non-zero index makes request
+// block until remote revision gets greater than index.
+func (rn *httpRemoteNodes) fetch(ctx context.Context, dc string, index uint64) ([]model.Node, uint64, error) {
+	dtoNodes := []dto.Node{}
+	req := rn.dcs[dc].cl.R().
+		SetContext(ctx).
+		SetResult(&dtoNodes).
+		ForceContentType("application/json")
+	if index > 0 {
+		req.SetQueryParams(map[string]string{
+			"index": strconv.FormatUint(index, 10),
+			"wait":  pollWait.String(),
+		})
+	}
+
+	resp, err := req.Get("/node")
+	if err != nil {
+		return nil, 0, fmt.Errorf("executing request: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, 0, fmt.Errorf("got non-ok response (%s): %s", resp.Status(), resp.String())
+	}
+
+	rev, err := strconv.ParseUint(resp.Header().Get(indexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing index header: %w", err)
+	}
+
+	nodes := make([]model.Node, 0, len(dtoNodes))
+	for _, n := range dtoNodes {
+		mn, err := n.ToModel(dc)
+		if err != nil {
+			return nil, 0, fmt.Errorf("converting node %s to model: %w", n.ID, err)
+		}
+		nodes = append(nodes, mn)
+	}
+
+	return nodes, rev, nil
+}
+
+func (rn *httpRemoteNodes) set(dc string, nodes []model.Node, rev uint64) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	st := rn.dcs[dc]
+	if !st.synced {
+		rn.logger.
+			Info().
+			Str("datacenter", dc).
+			Int("nodes", len(nodes)).
+			Msg("Datacenter synced")
+	}
+
+	st.synced = true
+	st.syncedAt = time.Now()
+	st.failing = false
+	st.nodes = nodes
+	st.rev = rev
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+func (rn *httpRemoteNodes) setFailing(dc string) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	rn.dcs[dc].failing = true
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,188 @@
+package http_remote_nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes/http_remote_nodes"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes/http_remote_nodes/dto"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = zerolog.New(zerolog.ConsoleWriter{
+	Out:        os.Stdout,
+	TimeFormat: time.RFC3339,
+}).With().Timestamp().Logger()
+
+// remote is discovery listing its nodes with blocking queries.
+type remote struct {
+	mu      sync.Mutex
+	down    bool
+	rev     uint64
+	nodes   []dto.Node
+	changed chan struct{}
+}
+
+// setDown makes remote respond with error, including blocked polls.
+func (r *remote) setDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.down = true
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *remote) set(rev uint64, nodes ...dto.Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rev, r.nodes = rev, nodes
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *remote) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("X-Api-Key") != "remote_key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	index, _ := strconv.ParseUint(req.URL.Query().Get("index"), 10, 64)
+	for {
+		r.mu.Lock()
+		down, rev, nodes, changed := r.down, r.rev, r.nodes, r.changed
+		r.mu.Unlock()
+
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if index == 0 || rev > index {
+			w.Header().Set("X-Discovery-Index", strconv.FormatUint(rev, 10))
+			_ = json.NewEncoder(w).Encode(nodes)
+			return
+		}
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+func TestRemoteNodes(t *testing.T) {
+	rem := &remote{changed: make(chan struct{})}
+	rem.set(1, dto.Node{ID: "node1_id", ServiceName: "fooBarService", State: "up"})
+
+	serv := httptest.NewServer(rem)
+	defer serv.Close()
+
+	repo, err := http_remote_nodes.New(
+		[]http_remote_nodes.Peer{{Datacenter: "eu-west", URL: serv.URL, APIKey: "remote_key"}},
+		0,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// Blocked polls are done before the server is closed.
+	startCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = repo.Start(startCtx)
+	}()
+
+	_, _, err = repo.GetAll(ctx, "us-east")
+	require.ErrorIs(t, err, remote_nodes.ErrUnknownDatacenter)
+
+	rev, err := repo.WaitRevision(ctx, "eu-west", 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), rev)
+
+	nodes, rev, err := repo.GetAll(ctx, "eu-west")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), rev)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "node1_id", nodes[0].ID)
+	assert.Equal(t, model.StateUp, nodes[0].State)
+	assert.Equal(t, "eu-west", nodes[0].Datacenter)
+
+	// Changes are picked up by the blocked poll.
+	rem.set(2,
+		dto.Node{ID: "node1_id", ServiceName: "fooBarService", State: "down"},
+		dto.Node{ID: "node2_id", ServiceName: "fooBarService", State: "up"},
+	)
+	rev, err = repo.WaitRevision(ctx, "eu-west", 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), rev)
+
+	nodes, _, err = repo.GetAll(ctx, "eu-west")
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, model.StateDown, nodes[0].State)
+	assert.Equal(t, "node2_id", nodes[1].ID)
+}
+
+func TestRemoteNodesStale(t *testing.T) {
+	rem := &remote{changed: make(chan struct{})}
+	rem.set(1, dto.Node{ID: "node1_id", ServiceName: "fooBarService", State: "up"})
+
+	serv := httptest.NewServer(rem)
+	defer serv.Close()
+
+	repo, err := http_remote_nodes.New(
+		[]http_remote_nodes.Peer{{Datacenter: "eu-west", URL: serv.URL, APIKey: "remote_key"}},
+		time.Millisecond*500,
+		logger,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	startCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = repo.Start(startCtx)
+	}()
+
+	_, err = repo.WaitRevision(ctx, "eu-west", 0)
+	require.NoError(t, err)
+
+	// Remote being idle longer than max staleness is not stale.
+	time.Sleep(time.Second)
+	_, _, err = repo.GetAll(ctx, "eu-west")
+	require.NoError(t, err)
+
+	// Unreachable remote is stale, as the last sync was longer than max staleness ago.
+	rem.setDown()
+	assert.Eventually(t, func() bool {
+		_, _, err := repo.GetAll(ctx, "eu-west")
+		return errors.Is(err, remote_nodes.ErrNotSynced)
+	}, time.Second*2, time.Millisecond*10)
+}
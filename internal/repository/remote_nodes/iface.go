@@ -0,0 +1,24 @@
+package remote_nodes
+
+import (
+	"context"
+	"errors"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+var (
+	ErrUnknownDatacenter = errors.New("unknown datacenter")
+	ErrNotSynced         = errors.New("datacenter is not synced yet")
+)
+
+// Repository is local cache of nodes of remote datacenters.
+type Repository interface {
+	Datacenters() []string
+	// GetAll returns nodes of the datacenter tagged with it,
+	// along with the remote global revision they are actual for.
+	GetAll(ctx context.Context, dc string) ([]model.Node, uint64, error)
+	// WaitRevision blocks until revision of the datacenter gets greater than index or ctx is done.
+	// Last known revision is returned in both cases.
+	WaitRevision(ctx context.Context, dc string, index uint64) (uint64, error)
+}
@@ -0,0 +1,119 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Discovery-Timestamp"
+	HeaderNonce     = "X-Discovery-Nonce"
+	HeaderSignature = "X-Discovery-Signature"
+
+	MaxSkew = time.Minute
+)
+
+var ErrBadSignature = errors.New("bad signature")
+
+// NewSecret generates per-node secret used to sign
+// requests from discovery to the node.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// Headers returns headers to be set on the request to sign it.
+// Every call produces new nonce, so retried request must be signed again.
+func Headers(secret string, method string, path string, body []byte, now time.Time) (map[string]string, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return map[string]string{
+		HeaderTimestamp: ts,
+		HeaderNonce:     nonce,
+		HeaderSignature: sign(secret, ts, nonce, method, path, body),
+	}, nil
+}
+
+// Verifier checks signatures made by Headers and rejects
+// requests with already seen nonces.
+type Verifier struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		seen: map[string]time.Time{},
+	}
+}
+
+func (v *Verifier) Verify(secret string, req *http.Request, body []byte, now time.Time) error {
+	ts := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	sig := req.Header.Get(HeaderSignature)
+	if ts == "" || nonce == "" || sig == "" {
+		return fmt.Errorf("%w: missing signature headers", ErrBadSignature)
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: parsing timestamp: %w", ErrBadSignature, err)
+	}
+	at := time.Unix(unix, 0)
+	if skew := now.Sub(at).Abs(); skew > MaxSkew {
+		return fmt.Errorf("%w: timestamp skew %s exceeds %s", ErrBadSignature, skew, MaxSkew)
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(sign(secret, ts, nonce, req.Method, req.URL.Path, body))) {
+		return fmt.Errorf("%w: signature mismatch", ErrBadSignature)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Requests older than MaxSkew are rejected as stale,
+	// so their nonces are no longer needed.
+	for n, seenAt := range v.seen {
+		if now.Sub(seenAt) > MaxSkew {
+			delete(v.seen, n)
+		}
+	}
+
+	if _, found := v.seen[nonce]; found {
+		return fmt.Errorf("%w: replayed nonce", ErrBadSignature)
+	}
+	v.seen[nonce] = at
+
+	return nil
+}
+
+func sign(secret string, ts string, nonce string, method string, path string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strings.Join(
+		[]string{ts, nonce, method, path, hex.EncodeToString(bodyHash[:])},
+		"\n",
+	)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("reading random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,55 @@
+package signature_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	secret, err := signature.NewSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	body := []byte(`{"ID":"node1_id","State":"down"}`)
+	newReq := func(method string, path string, headers map[string]string) *http.Request {
+		req := httptest.NewRequest(method, "http://localhost:9001"+path, bytes.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+	sign := func(method string, path string, at time.Time) map[string]string {
+		headers, err := signature.Headers(secret, method, path, body, at)
+		require.NoError(t, err)
+		return headers
+	}
+
+	v := signature.NewVerifier()
+
+	assert.NoError(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", sign(http.MethodPost, "/updateMe", now)), body, now))
+	assert.NoError(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", sign(http.MethodPost, "/updateMe", now)), body, now.Add(signature.MaxSkew/2)))
+
+	assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", nil), body, now), signature.ErrBadSignature)
+	assert.ErrorIs(t, v.Verify("other", newReq(http.MethodPost, "/updateMe", sign(http.MethodPost, "/updateMe", now)), body, now), signature.ErrBadSignature)
+	assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodGet, "/updateMe", sign(http.MethodPost, "/updateMe", now)), body, now), signature.ErrBadSignature)
+	assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodPost, "/health", sign(http.MethodPost, "/updateMe", now)), body, now), signature.ErrBadSignature)
+	assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", sign(http.MethodPost, "/updateMe", now)), []byte(`{}`), now), signature.ErrBadSignature)
+
+	t.Run("stale", func(t *testing.T) {
+		headers := sign(http.MethodPost, "/updateMe", now.Add(-2*signature.MaxSkew))
+		assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", headers), body, now), signature.ErrBadSignature)
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		headers := sign(http.MethodPost, "/updateMe", now)
+		require.NoError(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", headers), body, now))
+		assert.ErrorIs(t, v.Verify(secret, newReq(http.MethodPost, "/updateMe", headers), body, now.Add(time.Second)), signature.ErrBadSignature)
+	})
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const stdout = "stdout"
+
+type Provider struct {
+	tp   *sdktrace.TracerProvider
+	file *os.File
+}
+
+// New sets global tracer provider exporting spans as JSON lines
+// to the file at path, or to standard output for "stdout".
+// Empty path disables export, but trace context is still propagated.
+func New(path string, serviceName string) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	p := &Provider{}
+	if path == "" {
+		return p, nil
+	}
+
+	var w io.Writer = os.Stdout
+	if path != stdout {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening file %s: %w", path, err)
+		}
+		p.file = f
+		w = f
+	}
+
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, fmt.Errorf("creating exporter: %w", err)
+	}
+
+	p.tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(p.tp)
+
+	return p, nil
+}
+
+// Shutdown flushes pending spans.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	var resErr error
+	if p.tp != nil {
+		if err := p.tp.Shutdown(ctx); err != nil {
+			resErr = errors.Join(resErr, fmt.Errorf("shutting down tracer provider: %w", err))
+		}
+	}
+	if p.file != nil {
+		if err := p.file.Close(); err != nil {
+			resErr = errors.Join(resErr, fmt.Errorf("closing file: %w", err))
+		}
+	}
+	return resErr
+}
+
+// Inject returns trace context of ctx in form suitable
+// for passing it through channels and storages.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns ctx continuing trace context previously injected by Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// End records err, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
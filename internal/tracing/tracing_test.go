@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	p, err := New(path, "test")
+	require.NoError(t, err)
+
+	tracer := otel.Tracer("test")
+	ctx, parent := tracer.Start(context.TODO(), "parent")
+	carrier := Inject(ctx)
+	parent.End()
+	require.NotEmpty(t, carrier)
+
+	_, child := tracer.Start(Extract(context.TODO(), carrier), "child")
+	child.End()
+
+	require.NoError(t, p.Shutdown(context.TODO()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	type span struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ SpanID string }
+	}
+	spans := map[string]span{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	for dec.More() {
+		s := span{}
+		require.NoError(t, dec.Decode(&s))
+		spans[s.Name] = s
+	}
+
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans["parent"].SpanContext.TraceID, spans["child"].SpanContext.TraceID)
+	assert.Equal(t, spans["parent"].SpanContext.SpanID, spans["child"].Parent.SpanID)
+}
@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/samber/lo"
+)
+
+// catalog caches service summaries until the global revision changes.
+// Revision is bumped on every change of node routability, meta, registration
+// and removal, which covers everything summaries are built from.
+// Nodes are not cached, as their state may change without revision bump.
+type catalog struct {
+	mu        sync.Mutex
+	built     bool
+	rev       uint64
+	services  map[string]model.Service
+	removedAt map[string]time.Time
+}
+
+func newCatalog() *catalog {
+	return &catalog{
+		removedAt: map[string]time.Time{},
+	}
+}
+
+// nodeRemoved keeps time of the node removal as a service change,
+// since the node itself is gone from the repo.
+func (c *catalog) nodeRemoved(n model.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n.ChangedAt.After(c.removedAt[n.ServiceName]) {
+		c.removedAt[n.ServiceName] = n.ChangedAt
+	}
+	// Removal is reported after revision bump, so cache may be already rebuilt.
+	c.built = false
+}
+
+// Services returns summaries of all services having nodes, sorted by name.
+func (uc *Usecase) Services(ctx context.Context) ([]model.Service, error) {
+	uc.catalog.mu.Lock()
+	defer uc.catalog.mu.Unlock()
+
+	if err := uc.refreshCatalog(ctx); err != nil {
+		return nil, fmt.Errorf("refreshing catalog: %w", err)
+	}
+
+	res := slices.Collect(maps.Values(uc.catalog.services))
+	slices.SortFunc(res, func(a, b model.Service) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return res, nil
+}
+
+// Service returns summary of the service along with its nodes.
+func (uc *Usecase) Service(ctx context.Context, serviceName string) (model.Service, []model.Node, error) {
+	uc.catalog.mu.Lock()
+	defer uc.catalog.mu.Unlock()
+
+	if err := uc.refreshCatalog(ctx); err != nil {
+		return model.Service{}, nil, fmt.Errorf("refreshing catalog: %w", err)
+	}
+
+	s, found := uc.catalog.services[serviceName]
+	if !found {
+		return model.Service{}, nil, fmt.Errorf("%w: no nodes of service %s", nodes.ErrNotFound, serviceName)
+	}
+
+	ns, _, err := uc.GetAll(ctx, serviceName, model.Selector{})
+	if err != nil {
+		return model.Service{}, nil, fmt.Errorf("getting nodes: %w", err)
+	}
+
+	return s, ns, nil
+}
+
+// refreshCatalog rebuilds catalog if revision changed since the last build.
+// Must be called with uc.catalog.mu held.
+func (uc *Usecase) refreshCatalog(ctx context.Context) error {
+	c := uc.catalog
+
+	rev, err := uc.nodesRepo.Revision(ctx, "")
+	if err != nil {
+		return fmt.Errorf("getting revision from repo: %w", err)
+	}
+	if c.built && c.rev == rev {
+		return nil
+	}
+
+	all, err := uc.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes from repo: %w", err)
+	}
+	all = lo.UniqBy(
+		all,
+		func(el model.Node) string { return el.ID },
+	)
+
+	byService := lo.GroupBy(
+		all,
+		func(el model.Node) string { return el.ServiceName },
+	)
+	c.services = make(map[string]model.Service, len(byService))
+	for name, ns := range byService {
+		s := model.Service{
+			Name:       name,
+			Total:      len(ns),
+			LastChange: c.removedAt[name],
+		}
+
+		metaKeys := map[string]struct{}{}
+		for _, n := range ns {
+			if n.State.Routable() {
+				s.Up++
+			} else {
+				s.Down++
+			}
+			if s.FirstSeen.IsZero() || n.RegisteredAt.Before(s.FirstSeen) {
+				s.FirstSeen = n.RegisteredAt
+			}
+			if n.ChangedAt.After(s.LastChange) {
+				s.LastChange = n.ChangedAt
+			}
+			for k := range n.Meta {
+				metaKeys[k] = struct{}{}
+			}
+		}
+		s.MetaKeys = slices.Sorted(maps.Keys(metaKeys))
+
+		c.services[name] = s
+	}
+
+	c.built = true
+	c.rev = rev
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type noUpds struct{}
+
+func (noUpds) Out() <-chan model.Node { return nil }
+
+type noGw struct{}
+
+func (noGw) Send(context.Context, model.Event, []model.Node) error { return nil }
+
+func TestCatalog(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	uc := New(nodesRepo, nil, nil, noUpds{}, noGw{}, "dc1", time.Second, zerolog.Nop())
+	ctx := context.TODO()
+
+	register := func(serviceName string, meta map[string]string) model.Node {
+		n, err := uc.Register(ctx, model.RegisterNodeRequest{
+			ServiceName: serviceName,
+			Meta:        meta,
+			Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+		})
+		require.NoError(t, err)
+		return n
+	}
+
+	foo := register("foo", map[string]string{"zone": "a", "version": "1"})
+	register("bar", nil)
+
+	services, err := uc.Services(ctx)
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Equal(t, "bar", services[0].Name)
+	assert.Equal(t, "foo", services[1].Name)
+	assert.Equal(t, 1, services[1].Total)
+	assert.Equal(t, 1, services[1].Down)
+	assert.True(t, foo.RegisteredAt.Equal(services[1].FirstSeen))
+	assert.True(t, foo.ChangedAt.Equal(services[1].LastChange))
+	assert.Equal(t, []string{"version", "zone"}, services[1].MetaKeys)
+
+	// Cache is rebuilt once revision changes.
+	register("foo", map[string]string{"weight": "10"})
+
+	s, ns, err := uc.Service(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Total)
+	assert.Equal(t, []string{"version", "weight", "zone"}, s.MetaKeys)
+	assert.Len(t, ns, 2)
+
+	_, _, err = uc.Service(ctx, "baz")
+	assert.ErrorIs(t, err, nodes.ErrNotFound)
+
+	// Nodes are actual even if revision is not bumped by the change.
+	_, err = uc.EnterMaintenance(ctx, foo.ID, "upgrade", 0)
+	require.NoError(t, err)
+	_, ns, err = uc.Service(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, model.StateDraining, lo.FindOrElse(ns, model.Node{}, func(el model.Node) bool { return el.ID == foo.ID }).State)
+
+	require.NoError(t, uc.processMaintenance(ctx, time.Now().Add(time.Second)))
+	_, ns, err = uc.Service(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, model.StateMaintenance, lo.FindOrElse(ns, model.Node{}, func(el model.Node) bool { return el.ID == foo.ID }).State)
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
+	"github.com/samber/lo"
+)
+
+// AllDatacenters is datacenter name requesting merged view
+// of the local and all remote datacenters.
+const AllDatacenters = "all"
+
+// GetAllIn is GetAll for the datacenter, which is the local one for empty dc.
+// Returned nodes are tagged with their datacenter.
+// Merged view of all datacenters has zero revision, as it has no common one.
+func (uc *Usecase) GetAllIn(ctx context.Context, dc string, serviceName string, sel model.Selector) ([]model.Node, uint64, error) {
+	switch dc {
+	case "", uc.datacenter:
+		nodes, rev, err := uc.GetAll(ctx, serviceName, sel)
+		if err != nil {
+			return nil, 0, err
+		}
+		return uc.tagLocal(nodes), rev, nil
+
+	case AllDatacenters:
+		nodes, _, err := uc.GetAll(ctx, serviceName, sel)
+		if err != nil {
+			return nil, 0, err
+		}
+		nodes = uc.tagLocal(nodes)
+
+		for _, remoteDC := range uc.remoteRepo.Datacenters() {
+			remote, _, err := uc.remoteRepo.GetAll(ctx, remoteDC)
+			// Datacenter unreachable since start or for too long is left out of merged view.
+			if errors.Is(err, remote_nodes.ErrNotSynced) {
+				continue
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("getting nodes of %s from remote repo: %w", remoteDC, err)
+			}
+			nodes = append(nodes, filterNodes(remote, serviceName, sel)...)
+		}
+
+		return nodes, 0, nil
+
+	default:
+		nodes, rev, err := uc.remoteRepo.GetAll(ctx, dc)
+		if err != nil {
+			return nil, 0, fmt.Errorf("getting nodes from remote repo: %w", err)
+		}
+		return filterNodes(nodes, serviceName, sel), rev, nil
+	}
+}
+
+// WaitRevisionIn is WaitRevision for the datacenter, which is the local one for empty dc.
+// Revision of remote datacenter is the global one, regardless of serviceName.
+func (uc *Usecase) WaitRevisionIn(ctx context.Context, dc string, serviceName string, index uint64, wait time.Duration) error {
+	switch dc {
+	case "", uc.datacenter:
+		return uc.WaitRevision(ctx, serviceName, index, wait)
+	case AllDatacenters:
+		return fmt.Errorf("%w: merged view of all datacenters can't be waited on", model.ErrInvalidRequest)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	_, err := uc.remoteRepo.WaitRevision(waitCtx, dc, index)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for revision in remote repo: %w", err)
+	}
+
+	return nil
+}
+
+func (uc *Usecase) tagLocal(nodes []model.Node) []model.Node {
+	return lo.Map(nodes, func(el model.Node, _ int) model.Node {
+		el.Datacenter = uc.datacenter
+		return el
+	})
+}
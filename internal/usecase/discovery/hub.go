@@ -0,0 +1,116 @@
+package discovery
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+const (
+	hubHistorySize = 1024
+	subChSize      = 256
+)
+
+// hub fans node events out to watchers and keeps the latest of them,
+// so that watcher can resume from revision it has seen.
+type hub struct {
+	mu      sync.Mutex
+	subs    map[*subscription]struct{}
+	history []model.Event
+	lastRev map[string]uint64
+}
+
+type subscription struct {
+	serviceName string
+	ch          chan model.Event
+}
+
+func newHub() *hub {
+	return &hub{
+		subs:    map[*subscription]struct{}{},
+		lastRev: map[string]uint64{},
+	}
+}
+
+// publish sends event to subscribers of its service.
+// Subscriber not keeping up is dropped by closing its channel.
+func (h *hub) publish(ev model.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.history = append(h.history, ev)
+	if len(h.history) > hubHistorySize {
+		h.history = h.history[len(h.history)-hubHistorySize:]
+	}
+	h.lastRev[ev.Node.ServiceName] = max(h.lastRev[ev.Node.ServiceName], ev.Node.Revision)
+
+	for sub := range h.subs {
+		if sub.serviceName != ev.Node.ServiceName {
+			continue
+		}
+
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// subscribe registers subscriber of the service events.
+// If since is not zero, events of the service after since are replayed
+// and resumed is true. If any of them is missing from history,
+// nothing is replayed and resumed is false.
+func (h *hub) subscribe(serviceName string, since uint64) (sub *subscription, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &subscription{
+		serviceName: serviceName,
+		ch:          make(chan model.Event, subChSize),
+	}
+	h.subs[sub] = struct{}{}
+
+	if since == 0 {
+		return sub, false
+	}
+	if since == h.lastRev[serviceName] {
+		return sub, true
+	}
+
+	var replay []model.Event
+	for _, ev := range h.history {
+		if ev.Node.ServiceName == serviceName && ev.Node.Revision > since {
+			replay = append(replay, ev)
+		}
+	}
+	// Expiry removals are published apart from other changes,
+	// so events may come slightly out of order.
+	slices.SortFunc(replay, func(a, b model.Event) int {
+		return cmp.Compare(a.Node.Revision, b.Node.Revision)
+	})
+
+	// Revisions of the service are sequential,
+	// so gap means some of events are lost.
+	if len(replay) == 0 || len(replay) > subChSize || replay[0].Node.Revision != since+1 {
+		return sub, false
+	}
+
+	for _, ev := range replay {
+		sub.ch <- ev
+	}
+	return sub, true
+}
+
+func (h *hub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, found := h.subs[sub]; found {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,58 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	h := newHub()
+	publish := func(serviceName string, rev uint64) {
+		h.publish(model.Event{
+			Kind: model.EventKindUpdated,
+			Node: model.Node{ServiceName: serviceName, Revision: rev},
+		})
+	}
+
+	publish("foo", 1)
+	publish("bar", 1)
+	publish("foo", 2)
+	publish("foo", 3)
+
+	revisions := func(sub *subscription) []uint64 {
+		res := []uint64{}
+		for len(sub.ch) > 0 {
+			res = append(res, (<-sub.ch).Node.Revision)
+		}
+		return res
+	}
+
+	sub, resumed := h.subscribe("foo", 1)
+	require.True(t, resumed)
+	assert.Equal(t, []uint64{2, 3}, revisions(sub))
+
+	sub, resumed = h.subscribe("foo", 3)
+	require.True(t, resumed)
+	assert.Empty(t, revisions(sub))
+
+	sub, resumed = h.subscribe("foo", 0)
+	require.False(t, resumed)
+	assert.Empty(t, revisions(sub))
+
+	publish("foo", 4)
+	publish("bar", 2)
+	assert.Equal(t, []uint64{4}, revisions(sub))
+
+	// Revision 6 is lost.
+	publish("foo", 7)
+	_, resumed = h.subscribe("foo", 5)
+	assert.False(t, resumed)
+
+	assert.Equal(t, []uint64{7}, revisions(sub))
+	h.unsubscribe(sub)
+	_, ok := <-sub.ch
+	assert.False(t, ok)
+}
@@ -0,0 +1,173 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/samber/lo"
+)
+
+const maintenanceCheckIvl = time.Second
+
+// EnterMaintenance takes node out of rotation.
+// Node is draining for drainDur and then stays in maintenance
+// until ExitMaintenance call or dur expiry (zero dur means no expiry).
+func (uc *Usecase) EnterMaintenance(
+	ctx context.Context,
+	id string,
+	reason string,
+	dur time.Duration,
+) (model.Node, error) {
+	now := time.Now()
+
+	n, err := uc.update(ctx, id, func(n *model.Node) error {
+		if n.State != model.StateDraining && n.State != model.StateMaintenance {
+			if !n.State.CanTransitTo(model.StateDraining) {
+				return fmt.Errorf("%w: %s -> %s", model.ErrInvalidStateTransition, n.State, model.StateDraining)
+			}
+			n.State = model.StateDraining
+		}
+
+		n.Maintenance = &model.Maintenance{
+			Reason: reason,
+			Since:  now,
+		}
+		if dur > 0 {
+			n.Maintenance.Until = now.Add(dur)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.Node{}, fmt.Errorf("updating node: %w", err)
+	}
+
+	return n, nil
+}
+
+// ExitMaintenance returns node to rotation. Node starts over as a new one.
+func (uc *Usecase) ExitMaintenance(ctx context.Context, id string) (model.Node, error) {
+	n, err := uc.update(ctx, id, func(n *model.Node) error {
+		if n.State != model.StateDraining && n.State != model.StateMaintenance {
+			return nil
+		}
+
+		n.State = model.StateStarting
+		n.Maintenance = nil
+		return nil
+	})
+	if err != nil {
+		return model.Node{}, fmt.Errorf("updating node: %w", err)
+	}
+
+	return n, nil
+}
+
+func (uc *Usecase) EnterServiceMaintenance(
+	ctx context.Context,
+	serviceName string,
+	reason string,
+	dur time.Duration,
+) ([]model.Node, error) {
+	return uc.forEachServiceNode(ctx, serviceName, func(id string) (model.Node, error) {
+		return uc.EnterMaintenance(ctx, id, reason, dur)
+	})
+}
+
+func (uc *Usecase) ExitServiceMaintenance(ctx context.Context, serviceName string) ([]model.Node, error) {
+	return uc.forEachServiceNode(ctx, serviceName, func(id string) (model.Node, error) {
+		return uc.ExitMaintenance(ctx, id)
+	})
+}
+
+func (uc *Usecase) forEachServiceNode(
+	ctx context.Context,
+	serviceName string,
+	fn func(id string) (model.Node, error),
+) ([]model.Node, error) {
+	nodes, err := uc.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting nodes from repo: %w", err)
+	}
+
+	nodes = lo.Filter(
+		nodes,
+		func(el model.Node, _ int) bool {
+			return el.ServiceName == serviceName && el.State != model.StateDown
+		},
+	)
+
+	res := make([]model.Node, 0, len(nodes))
+	for _, node := range nodes {
+		n, err := fn(node.ID)
+		if err != nil {
+			return nil, fmt.Errorf("processing node %s: %w", node.ID, err)
+		}
+		res = append(res, n)
+	}
+
+	return res, nil
+}
+
+// StartMaintenance completes draining and expires finished maintenances
+// until ctx is done. In cluster it is to be run on the leader only.
+func (uc *Usecase) StartMaintenance(ctx context.Context) error {
+	ticker := time.NewTicker(maintenanceCheckIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("running context: %w", ctx.Err())
+
+		case now := <-ticker.C:
+			if err := uc.processMaintenance(ctx, now); err != nil && !errors.Is(err, context.Canceled) {
+				uc.logger.
+					Error().
+					Err(fmt.Errorf("processing maintenance: %w", err)).
+					Send()
+			}
+		}
+	}
+}
+
+// processMaintenance completes draining and expires finished maintenances.
+func (uc *Usecase) processMaintenance(ctx context.Context, now time.Time) error {
+	nodes, err := uc.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting nodes from repo: %w", err)
+	}
+
+	for _, node := range nodes {
+		if node.Maintenance == nil {
+			continue
+		}
+
+		switch {
+		case node.State != model.StateDraining && node.State != model.StateMaintenance:
+			continue
+
+		case !node.Maintenance.Until.IsZero() && now.After(node.Maintenance.Until):
+			if _, err := uc.ExitMaintenance(ctx, node.ID); err != nil {
+				return fmt.Errorf("exiting maintenance for node %s: %w", node.ID, err)
+			}
+
+		case node.State == model.StateDraining && now.Sub(node.Maintenance.Since) >= uc.drainDur:
+			_, err := uc.update(ctx, node.ID, func(n *model.Node) error {
+				if n.State != model.StateDraining {
+					return nil
+				}
+				n.State = model.StateMaintenance
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("finishing drain for node %s: %w", node.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	const drainDur = time.Minute
+	gw := &recGw{}
+	uc := New(nodesRepo, nil, nil, noUpds{}, gw, "dc1", drainDur, zerolog.Nop())
+	ctx := context.TODO()
+
+	n, err := uc.Register(ctx, model.RegisterNodeRequest{
+		ServiceName: "foo",
+		Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+	})
+	require.NoError(t, err)
+	n, err = uc.update(ctx, n.ID, func(n *model.Node) error { n.State = model.StateUp; return nil })
+	require.NoError(t, err)
+	evsNum := len(gw.evs)
+
+	// Node is taken out of rotation right away, and receivers are notified.
+	drained, err := uc.EnterMaintenance(ctx, n.ID, "upgrade", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateDraining, drained.State)
+	require.NotNil(t, drained.Maintenance)
+	assert.Equal(t, "upgrade", drained.Maintenance.Reason)
+	assert.Equal(t, drained.Maintenance.Since.Add(time.Hour), drained.Maintenance.Until)
+	assert.Greater(t, drained.Revision, n.Revision)
+	require.Len(t, gw.evs, evsNum+1)
+	assert.Equal(t, model.StateDraining, gw.evs[evsNum].Node.State)
+
+	// Drain is not finished before drainDur.
+	since := drained.Maintenance.Since
+	require.NoError(t, uc.processMaintenance(ctx, since.Add(drainDur/2)))
+	stored, err := nodesRepo.Get(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateDraining, stored.State)
+
+	// Finished drain does not change routing, so it is not broadcast.
+	require.NoError(t, uc.processMaintenance(ctx, since.Add(drainDur)))
+	stored, err = nodesRepo.Get(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateMaintenance, stored.State)
+	assert.Equal(t, drained.Revision, stored.Revision)
+	assert.Len(t, gw.evs, evsNum+1)
+
+	// Entering again only updates maintenance info.
+	again, err := uc.EnterMaintenance(ctx, n.ID, "still upgrading", 0)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateMaintenance, again.State)
+	assert.Equal(t, "still upgrading", again.Maintenance.Reason)
+	assert.True(t, again.Maintenance.Until.IsZero())
+
+	// Maintenance without expiry lasts until exit.
+	require.NoError(t, uc.processMaintenance(ctx, since.Add(time.Hour*24)))
+	stored, err = nodesRepo.Get(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateMaintenance, stored.State)
+
+	exited, err := uc.ExitMaintenance(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateStarting, exited.State)
+	assert.Nil(t, exited.Maintenance)
+
+	// Exit of node not in maintenance changes nothing.
+	same, err := uc.ExitMaintenance(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, exited, same)
+
+	// Expired maintenance is exited by processing.
+	drained, err = uc.EnterMaintenance(ctx, n.ID, "reboot", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, uc.processMaintenance(ctx, drained.Maintenance.Until.Add(time.Second)))
+	stored, err = nodesRepo.Get(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StateStarting, stored.State)
+	assert.Nil(t, stored.Maintenance)
+
+	require.NoError(t, uc.Deregister(ctx, n.ID))
+	_, err = uc.EnterMaintenance(ctx, n.ID, "", 0)
+	require.ErrorIs(t, err, model.ErrInvalidStateTransition)
+}
+
+func TestServiceMaintenance(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	uc := New(nodesRepo, nil, nil, noUpds{}, noGw{}, "dc1", time.Second, zerolog.Nop())
+	ctx := context.TODO()
+
+	ids := map[string]struct{}{}
+	for _, service := range []string{"foo", "foo", "foo", "bar"} {
+		n, err := uc.Register(ctx, model.RegisterNodeRequest{
+			ServiceName: service,
+			Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+		})
+		require.NoError(t, err)
+		if service == "foo" {
+			ids[n.ID] = struct{}{}
+		}
+	}
+	rev, err := nodesRepo.Revision(ctx, "foo")
+	require.NoError(t, err)
+
+	// Deregistered nodes are skipped.
+	var downID string
+	for id := range ids {
+		downID = id
+		break
+	}
+	require.NoError(t, uc.Deregister(ctx, downID))
+	delete(ids, downID)
+
+	drained, err := uc.EnterServiceMaintenance(ctx, "foo", "migration", 0)
+	require.NoError(t, err)
+	require.Len(t, drained, len(ids))
+	for _, n := range drained {
+		assert.Contains(t, ids, n.ID)
+		assert.Equal(t, model.StateDraining, n.State)
+		assert.Equal(t, "migration", n.Maintenance.Reason)
+	}
+
+	newRev, err := nodesRepo.Revision(ctx, "foo")
+	require.NoError(t, err)
+	assert.Greater(t, newRev, rev)
+
+	bar, _, err := uc.GetAll(ctx, "bar", model.Selector{})
+	require.NoError(t, err)
+	require.Len(t, bar, 1)
+	assert.Equal(t, model.StateStarting, bar[0].State)
+
+	exited, err := uc.ExitServiceMaintenance(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, exited, len(ids))
+	for _, n := range exited {
+		assert.Equal(t, model.StateStarting, n.State)
+		assert.Nil(t, n.Maintenance)
+	}
+}
@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/horockey/service_discovery/internal/model"
+)
+
+// ReplaceMeta sets meta of the node.
+func (uc *Usecase) ReplaceMeta(ctx context.Context, id string, meta map[string]string) (model.Node, error) {
+	return uc.updateMeta(ctx, id, func(map[string]string) map[string]string {
+		return meta
+	})
+}
+
+// PatchMeta sets meta keys of the node with non-nil values in patch
+// and deletes the ones with nil values.
+func (uc *Usecase) PatchMeta(ctx context.Context, id string, patch map[string]*string) (model.Node, error) {
+	return uc.updateMeta(ctx, id, func(meta map[string]string) map[string]string {
+		res := maps.Clone(meta)
+		if res == nil {
+			res = map[string]string{}
+		}
+		for k, v := range patch {
+			if v == nil {
+				delete(res, k)
+			} else {
+				res[k] = *v
+			}
+		}
+		return res
+	})
+}
+
+// updateMeta applies fn to meta of the stored node and saves the result.
+// Other nodes of the service are notified with meta-changed event if meta changed.
+func (uc *Usecase) updateMeta(ctx context.Context, id string, fn func(meta map[string]string) map[string]string) (model.Node, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	n, err := uc.nodesRepo.Get(ctx, id)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("getting node from repo: %w", err)
+	}
+
+	meta := fn(n.Meta)
+	if maps.Equal(n.Meta, meta) {
+		return n, nil
+	}
+	n.Meta = meta
+
+	n, err = uc.saveChange(ctx, n)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("updating repo: %w", err)
+	}
+
+	if err := uc.notify(ctx, model.Event{Kind: model.EventKindMetaChanged, Node: n}); err != nil {
+		return model.Node{}, fmt.Errorf("notifying receivers: %w", err)
+	}
+
+	return n, nil
+}
@@ -2,45 +2,84 @@ package discovery
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/horockey/service_discovery/internal/extractor/health_upds"
 	"github.com/horockey/service_discovery/internal/gateway/nodes_updates"
+	"github.com/horockey/service_discovery/internal/metrics"
 	"github.com/horockey/service_discovery/internal/model"
 	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/outbox"
+	"github.com/horockey/service_discovery/internal/repository/remote_nodes"
+	"github.com/horockey/service_discovery/internal/signature"
+	"github.com/horockey/service_discovery/internal/tracing"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/horockey/service_discovery/internal/usecase/discovery")
+
 type Usecase struct {
-	nodesRepo nodes.Repository
-	upds      health_upds.Extractor
-	gw        nodes_updates.Gateway
-	logger    zerolog.Logger
+	mu         sync.Mutex
+	nodesRepo  nodes.Repository
+	outboxRepo outbox.Repository
+	remoteRepo remote_nodes.Repository
+	upds       health_upds.Extractor
+	gw         nodes_updates.Gateway
+	hub        *hub
+	catalog    *catalog
+	datacenter string
+	drainDur   time.Duration
+	logger     zerolog.Logger
 }
 
 func New(
 	nodesRepo nodes.Repository,
+	outboxRepo outbox.Repository,
+	remoteRepo remote_nodes.Repository,
 	upds health_upds.Extractor,
 	gw nodes_updates.Gateway,
+	datacenter string,
+	drainDur time.Duration,
 	logger zerolog.Logger,
 ) *Usecase {
 	return &Usecase{
-		nodesRepo: nodesRepo,
-		upds:      upds,
-		gw:        gw,
-		logger:    logger,
+		nodesRepo:  nodesRepo,
+		outboxRepo: outboxRepo,
+		remoteRepo: remoteRepo,
+		upds:       upds,
+		gw:         gw,
+		hub:        newHub(),
+		catalog:    newCatalog(),
+		datacenter: datacenter,
+		drainDur:   drainDur,
+		logger:     logger,
 	}
 }
 
+// Start applies node updates and removals.
+// Maintenance is processed separately, see StartMaintenance.
 func (uc *Usecase) Start(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("running context: %w", ctx.Err())
 
+		case n := <-uc.nodesRepo.Removed():
+			uc.catalog.nodeRemoved(n)
+			uc.hub.publish(model.Event{
+				Kind: model.EventKindRemoved,
+				Node: n,
+			})
+
 		case upd := <-uc.upds.Out():
 			uc.logger.Debug().
 				Str("ID", upd.ID).
@@ -48,71 +87,197 @@ func (uc *Usecase) Start(ctx context.Context) error {
 				Str("state", upd.State.String()).
 				Msg("Get node upd")
 
-			if err := uc.nodesRepo.AddOrUpdate(ctx, upd); err != nil && !errors.Is(err, context.Canceled) {
+			updCtx, span := tracer.Start(tracing.Extract(ctx, upd.Trace), "usecase.apply_upd", trace.WithAttributes(
+				attribute.String("node.id", upd.ID),
+				attribute.String("node.state", upd.State.String()),
+			))
+			_, err := uc.update(updCtx, upd.ID, func(n *model.Node) error {
+				if !n.State.CanTransitTo(upd.State) {
+					return fmt.Errorf("%w: %s -> %s", model.ErrInvalidStateTransition, n.State, upd.State)
+				}
+				n.State = upd.State
+				n.Damped = upd.Damped
+				return nil
+			})
+			tracing.End(span, err)
+			switch {
+			case err == nil, errors.Is(err, context.Canceled):
+			case errors.Is(err, model.ErrInvalidStateTransition), errors.Is(err, nodes.ErrNotFound):
 				uc.logger.
-					Error().
-					Err(fmt.Errorf("updating repo: %w", err)).
+					Warn().
+					Str("ID", upd.ID).
+					Err(fmt.Errorf("applying node upd: %w", err)).
 					Send()
-				continue
-			}
-
-			receivers, err := uc.nodesRepo.GetAll(ctx)
-			if err != nil {
+			default:
 				uc.logger.
 					Error().
-					Err(fmt.Errorf("getting list of receivers from repo: %w", err)).
+					Err(fmt.Errorf("applying node upd: %w", err)).
 					Send()
-				continue
-			}
-			receivers = lo.Filter(
-				receivers,
-				func(el model.Node, _ int) bool {
-					return el.ServiceName == upd.ServiceName &&
-						el.ID != upd.ID
-				},
-			)
-
-			if err := uc.gw.Send(ctx, upd, receivers); err != nil {
-				uc.logger.
-					Error().
-					Err(fmt.Errorf("sending upd to gw: %w", err)).
-					Send()
-				continue
 			}
 		}
 	}
 }
 
-func (uc *Usecase) Register(ctx context.Context, req model.RegisterNodeRequest) (model.Node, error) {
-	n := model.Node{
-		ID:             uuid.NewString(),
-		Hostname:       req.Hostname,
-		ServiceName:    req.ServiceName,
-		HealthEndpoint: req.HealthEndpoint,
-		UpdEndpoint:    req.UpdEndpoint,
-		State:          model.StateDown,
-		Meta:           req.Meta,
+func (uc *Usecase) Register(ctx context.Context, req model.RegisterNodeRequest) (_ model.Node, resErr error) {
+	ctx, span := tracer.Start(ctx, "usecase.register", trace.WithAttributes(
+		attribute.String("node.service", req.ServiceName),
+		attribute.String("node.hostname", req.Hostname),
+	))
+	defer func() { tracing.End(span, resErr) }()
+
+	if err := req.Validate(); err != nil {
+		return model.Node{}, fmt.Errorf("validating request: %w", err)
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	prev, found, err := uc.registered(ctx, req)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("looking up registered node: %w", err)
+	}
+
+	// Live node is only updated by its owner. Node which instance is gone
+	// is taken over by anyone, e.g. by the restarted instance, and gets new secret,
+	// so that the previous owner can't use it anymore.
+	rotateSecret := false
+	if found && prev.Secret != "" && subtle.ConstantTimeCompare([]byte(req.Secret), []byte(prev.Secret)) != 1 {
+		if !prev.State.Expirable() {
+			return model.Node{}, fmt.Errorf("%w: node %s", model.ErrSecretMismatch, prev.ID)
+		}
+		rotateSecret = true
+	}
+
+	n := prev
+	if !found {
+		n = model.Node{
+			ID:           lo.CoalesceOrEmpty(req.ID, uuid.NewString()),
+			ServiceName:  req.ServiceName,
+			State:        model.StateStarting,
+			RegisteredAt: time.Now(),
+		}
+	}
+	n.Hostname = req.Hostname
+	n.HealthEndpoint = req.HealthEndpoint
+	n.UpdEndpoint = req.UpdEndpoint
+	n.Meta = req.Meta
+	n.Check = req.Check
+
+	// Secret of re-registered node is kept, as pending deliveries are signed with it.
+	// Nodes registered before per-node secrets were introduced get one.
+	if n.Secret == "" || rotateSecret {
+		if n.Secret, err = signature.NewSecret(); err != nil {
+			return model.Node{}, fmt.Errorf("generating node secret: %w", err)
+		}
 	}
 
-	if err := uc.nodesRepo.AddOrUpdate(ctx, n); err != nil {
+	// Instance is back after failure or deregistration,
+	// so it is checked from scratch.
+	if found && n.State.Expirable() {
+		n.State = model.StateStarting
+		n.Heartbeat = nil
+		n.RegisteredAt = time.Now()
+	}
+
+	n, err = uc.saveChange(ctx, n)
+	if err != nil {
 		return model.Node{}, fmt.Errorf("adding node to repo: %w", err)
 	}
 
+	if found && n.State != prev.State {
+		metrics.StateTransitions.
+			WithLabelValues(n.ServiceName, prev.State.String(), n.State.String()).
+			Inc()
+	}
+
+	if err := uc.notify(ctx, model.Event{Kind: model.EventKindUpdated, Node: n}); err != nil {
+		return model.Node{}, fmt.Errorf("notifying receivers: %w", err)
+	}
+
 	return n, nil
 }
 
+// registered returns node re-registered by the request: the one with requested ID,
+// or the one of the service on the same host if ID is not requested.
+func (uc *Usecase) registered(ctx context.Context, req model.RegisterNodeRequest) (model.Node, bool, error) {
+	if req.ID != "" {
+		n, err := uc.nodesRepo.Get(ctx, req.ID)
+		if errors.Is(err, nodes.ErrNotFound) {
+			return model.Node{}, false, nil
+		}
+		if err != nil {
+			return model.Node{}, false, fmt.Errorf("getting node from repo: %w", err)
+		}
+		if n.ServiceName != req.ServiceName {
+			return model.Node{}, false, fmt.Errorf("%w: node %s is registered for service %s", model.ErrInvalidRequest, n.ID, n.ServiceName)
+		}
+		return n, true, nil
+	}
+
+	if req.Hostname == "" {
+		return model.Node{}, false, nil
+	}
+
+	all, err := uc.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return model.Node{}, false, fmt.Errorf("getting nodes from repo: %w", err)
+	}
+	same := lo.Filter(all, func(el model.Node, _ int) bool {
+		return el.ServiceName == req.ServiceName && el.Hostname == req.Hostname
+	})
+	if len(same) == 0 {
+		return model.Node{}, false, nil
+	}
+
+	// Duplicates registered before are resolved to the latest one.
+	return lo.MaxBy(same, func(a, b model.Node) bool { return a.RegisteredAt.After(b.RegisteredAt) }), true, nil
+}
+
 func (uc *Usecase) Deregister(ctx context.Context, id string) error {
-	if err := uc.nodesRepo.SetDown(ctx, id); err != nil {
-		return fmt.Errorf("removing node from repo: %w", err)
+	_, err := uc.update(ctx, id, func(n *model.Node) error {
+		n.State = model.StateDown
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("setting node down: %w", err)
 	}
 
 	return nil
 }
 
-func (uc *Usecase) GetAll(ctx context.Context, serviceName string) ([]model.Node, error) {
+// Heartbeat reports health of the node with ttl check.
+func (uc *Usecase) Heartbeat(ctx context.Context, id string, status model.CheckStatus, note string) (model.Node, error) {
+	n, err := uc.update(ctx, id, func(n *model.Node) error {
+		if n.Check.Kind != model.CheckKindTtl {
+			return fmt.Errorf("%w: node has %s check", model.ErrInvalidRequest, n.Check.Kind)
+		}
+
+		n.Heartbeat = &model.Heartbeat{
+			At:     time.Now(),
+			Status: status,
+			Note:   note,
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Node{}, fmt.Errorf("updating node: %w", err)
+	}
+
+	return n, nil
+}
+
+// GetAll returns nodes of the service, or all nodes for empty serviceName,
+// matching the selector, along with the revision they are actual for.
+func (uc *Usecase) GetAll(ctx context.Context, serviceName string, sel model.Selector) ([]model.Node, uint64, error) {
+	// Revision is read first, so that returned nodes are at least as new as it.
+	rev, err := uc.nodesRepo.Revision(ctx, serviceName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting revision from repo: %w", err)
+	}
+
 	nodes, err := uc.nodesRepo.GetAll(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("getting node from")
+		return nil, 0, fmt.Errorf("getting nodes from repo: %w", err)
 	}
 
 	nodes = lo.UniqBy(
@@ -120,11 +285,174 @@ func (uc *Usecase) GetAll(ctx context.Context, serviceName string) ([]model.Node
 		func(el model.Node) string { return el.ID },
 	)
 
+	return filterNodes(nodes, serviceName, sel), rev, nil
+}
+
+func filterNodes(nodes []model.Node, serviceName string, sel model.Selector) []model.Node {
 	return lo.Filter(
-			nodes,
-			func(el model.Node, _ int) bool {
-				return el.ServiceName == serviceName || serviceName == ""
-			},
-		),
-		nil
+		nodes,
+		func(el model.Node, _ int) bool {
+			return (el.ServiceName == serviceName || serviceName == "") && sel.Matches(el)
+		},
+	)
+}
+
+// WaitRevision blocks until revision of the service, or the global one
+// for empty serviceName, gets greater than index, or wait passes.
+func (uc *Usecase) WaitRevision(ctx context.Context, serviceName string, index uint64, wait time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	_, err := uc.nodesRepo.WaitRevision(waitCtx, serviceName, index)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for revision in repo: %w", err)
+	}
+
+	return nil
+}
+
+// DeadLetters returns node updates which failed to be delivered
+// to their receivers in time.
+func (uc *Usecase) DeadLetters(ctx context.Context) ([]model.Delivery, error) {
+	ds, err := uc.outboxRepo.GetDeadLetters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting dead letters from repo: %w", err)
+	}
+
+	return ds, nil
+}
+
+// update applies fn to the stored node and saves the result.
+// Other nodes of the service are notified if node routability changed.
+func (uc *Usecase) update(ctx context.Context, id string, fn func(n *model.Node) error) (model.Node, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	prev, err := uc.nodesRepo.Get(ctx, id)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("getting node from repo: %w", err)
+	}
+
+	n := prev
+	if err := fn(&n); err != nil {
+		return model.Node{}, err
+	}
+
+	drainStarted := n.State == model.StateDraining && prev.State != model.StateDraining
+	changed := prev.State.Routable() != n.State.Routable() || prev.Damped != n.Damped || drainStarted
+	if changed {
+		n, err = uc.saveChange(ctx, n)
+	} else {
+		err = uc.nodesRepo.AddOrUpdate(ctx, n)
+	}
+	if err != nil {
+		return model.Node{}, fmt.Errorf("updating repo: %w", err)
+	}
+
+	if n.State != prev.State {
+		metrics.StateTransitions.
+			WithLabelValues(n.ServiceName, prev.State.String(), n.State.String()).
+			Inc()
+	}
+
+	if !changed {
+		return n, nil
+	}
+
+	if err := uc.notify(ctx, model.Event{Kind: model.EventKindUpdated, Node: n}); err != nil {
+		return model.Node{}, fmt.Errorf("notifying receivers: %w", err)
+	}
+
+	return n, nil
+}
+
+// saveChange saves node change to be broadcast with the next service revision.
+// Must be called with uc.mu held, so that revisions are broadcast in order.
+func (uc *Usecase) saveChange(ctx context.Context, n model.Node) (model.Node, error) {
+	n.ChangedAt = time.Now()
+
+	n, err := uc.nodesRepo.AddOrUpdateWithRevision(ctx, n)
+	if err != nil {
+		return model.Node{}, fmt.Errorf("saving node with next revision: %w", err)
+	}
+
+	return n, nil
+}
+
+// notify publishes node change to watchers and sends it to other nodes of the service.
+func (uc *Usecase) notify(ctx context.Context, ev model.Event) (resErr error) {
+	upd := ev.Node
+	ctx, span := tracer.Start(ctx, "usecase.notify", trace.WithAttributes(
+		attribute.String("node.id", upd.ID),
+		attribute.String("event.kind", ev.Kind.String()),
+		attribute.Int64("node.revision", int64(upd.Revision)),
+	))
+	defer func() { tracing.End(span, resErr) }()
+
+	uc.hub.publish(ev)
+
+	receivers, err := uc.nodesRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("getting list of receivers from repo: %w", err)
+	}
+	receivers = lo.Filter(
+		receivers,
+		func(el model.Node, _ int) bool {
+			return el.ServiceName == upd.ServiceName &&
+				el.ID != upd.ID &&
+				el.UpdEndpoint != "" &&
+				!el.State.Expirable()
+		},
+	)
+
+	if err := uc.gw.Send(ctx, ev, receivers); err != nil {
+		return fmt.Errorf("sending upd to gw: %w", err)
+	}
+
+	return nil
+}
+
+// Watch is subscription to changes of the service nodes.
+type Watch struct {
+	// Resumed is true if events following revision seen by watcher
+	// are still kept and replayed. Otherwise Snapshot is set,
+	// and events with revision not greater than Revision must be skipped.
+	Resumed  bool
+	Snapshot []model.Node
+	Revision uint64
+	// Events is closed if watcher is not keeping up.
+	Events <-chan model.Event
+}
+
+// Watch subscribes to changes of the service nodes until ctx is done.
+// Non-zero since is the last revision seen by watcher.
+func (uc *Usecase) Watch(ctx context.Context, serviceName string, since uint64) (Watch, error) {
+	sub, resumed := uc.hub.subscribe(serviceName, since)
+	go func() {
+		<-ctx.Done()
+		uc.hub.unsubscribe(sub)
+	}()
+
+	if resumed {
+		return Watch{
+			Resumed:  true,
+			Revision: since,
+			Events:   sub.ch,
+		}, nil
+	}
+
+	// Subscription is made first, so that no change made after snapshot is missed.
+	snapshot, rev, err := uc.GetAll(ctx, serviceName, model.Selector{})
+	if err != nil {
+		return Watch{}, fmt.Errorf("getting snapshot: %w", err)
+	}
+
+	return Watch{
+		Snapshot: snapshot,
+		Revision: rev,
+		Events:   sub.ch,
+	}, nil
 }
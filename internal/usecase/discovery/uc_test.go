@@ -0,0 +1,197 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/horockey/service_discovery/internal/model"
+	"github.com/horockey/service_discovery/internal/repository/nodes"
+	"github.com/horockey/service_discovery/internal/repository/nodes/badger_nodes"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterIdempotent(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	uc := New(nodesRepo, nil, nil, noUpds{}, noGw{}, "dc1", time.Second, zerolog.Nop())
+	ctx := context.TODO()
+
+	req := model.RegisterNodeRequest{
+		Hostname:    "host1:8080",
+		ServiceName: "foo",
+		Meta:        map[string]string{"version": "1"},
+		Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+	}
+	first, err := uc.Register(ctx, req)
+	require.NoError(t, err)
+
+	// Live node is not updated without its secret.
+	req.Meta = map[string]string{"version": "2"}
+	_, err = uc.Register(ctx, req)
+	require.ErrorIs(t, err, model.ErrSecretMismatch)
+	req.Secret = "wrong"
+	_, err = uc.Register(ctx, req)
+	require.ErrorIs(t, err, model.ErrSecretMismatch)
+
+	// Re-registration from the same host updates the node in place.
+	req.Secret = first.Secret
+	second, err := uc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, first.Secret, second.Secret)
+	assert.Greater(t, second.Revision, first.Revision)
+
+	all, _, err := uc.GetAll(ctx, "foo", model.Selector{})
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "2", all[0].Meta["version"])
+
+	// Deregistered node is brought back by anyone, and its secret is rotated.
+	require.NoError(t, uc.Deregister(ctx, first.ID))
+	req.Secret = ""
+	third, err := uc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, third.ID)
+	assert.Equal(t, model.StateStarting, third.State)
+	assert.NotEmpty(t, third.Secret)
+	assert.NotEqual(t, first.Secret, third.Secret)
+
+	req.Secret = first.Secret
+	_, err = uc.Register(ctx, req)
+	require.ErrorIs(t, err, model.ErrSecretMismatch)
+
+	// Node with requested ID is updated regardless of its host.
+	req.ID = first.ID
+	req.Hostname = "host2:8080"
+	req.Secret = third.Secret
+	moved, err := uc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, moved.ID)
+	assert.Equal(t, "host2:8080", moved.Hostname)
+
+	req.ID = "custom-id"
+	custom, err := uc.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, "custom-id", custom.ID)
+
+	// ID of the node of another service can't be taken.
+	req.ServiceName = "bar"
+	_, err = uc.Register(ctx, req)
+	require.ErrorIs(t, err, model.ErrInvalidRequest)
+
+	req.ID = "bad id"
+	_, err = uc.Register(ctx, req)
+	require.ErrorIs(t, err, model.ErrInvalidRequest)
+}
+
+type recGw struct {
+	evs []model.Event
+}
+
+func (gw *recGw) Send(_ context.Context, ev model.Event, _ []model.Node) error {
+	gw.evs = append(gw.evs, ev)
+	return nil
+}
+
+func TestUpdateMeta(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	gw := &recGw{}
+	uc := New(nodesRepo, nil, nil, noUpds{}, gw, "dc1", time.Second, zerolog.Nop())
+	ctx := context.TODO()
+
+	n, err := uc.Register(ctx, model.RegisterNodeRequest{
+		ServiceName: "foo",
+		Meta:        map[string]string{"version": "1", "zone": "a"},
+		Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+	})
+	require.NoError(t, err)
+
+	two := "2"
+	patched, err := uc.PatchMeta(ctx, n.ID, map[string]*string{"version": &two, "zone": nil, "leader": &two})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"version": "2", "leader": "2"}, patched.Meta)
+	assert.Greater(t, patched.Revision, n.Revision)
+
+	require.Len(t, gw.evs, 2)
+	assert.Equal(t, model.EventKindMetaChanged, gw.evs[1].Kind)
+	assert.Equal(t, patched.Meta, gw.evs[1].Node.Meta)
+
+	// Unchanged meta is not broadcast.
+	same, err := uc.ReplaceMeta(ctx, n.ID, map[string]string{"version": "2", "leader": "2"})
+	require.NoError(t, err)
+	assert.Equal(t, patched.Revision, same.Revision)
+	assert.Len(t, gw.evs, 2)
+
+	replaced, err := uc.ReplaceMeta(ctx, n.ID, map[string]string{"zone": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"zone": "b"}, replaced.Meta)
+
+	stored, err := nodesRepo.Get(ctx, n.ID)
+	require.NoError(t, err)
+	assert.Equal(t, replaced.Meta, stored.Meta)
+
+	_, err = uc.PatchMeta(ctx, "unknown_id", nil)
+	require.ErrorIs(t, err, nodes.ErrNotFound)
+}
+
+func TestWaitRevisionThenRead(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	nodesRepo, err := badger_nodes.New(db, time.Minute)
+	require.NoError(t, err)
+
+	uc := New(nodesRepo, nil, nil, noUpds{}, noGw{}, "dc1", time.Second, zerolog.Nop())
+	ctx := context.TODO()
+
+	for i := range 50 {
+		_, rev, err := uc.GetAll(ctx, "foo", model.Selector{})
+		require.NoError(t, err)
+
+		type read struct {
+			nodes []model.Node
+			rev   uint64
+			err   error
+		}
+		readCh := make(chan read, 1)
+		go func() {
+			if err := uc.WaitRevision(ctx, "foo", rev, time.Second*5); err != nil {
+				readCh <- read{err: err}
+				return
+			}
+			nodes, rev, err := uc.GetAll(ctx, "foo", model.Selector{})
+			readCh <- read{nodes: nodes, rev: rev, err: err}
+		}()
+
+		n, err := uc.Register(ctx, model.RegisterNodeRequest{
+			Hostname:    fmt.Sprintf("host%d:8080", i),
+			ServiceName: "foo",
+			Check:       model.Check{Kind: model.CheckKindTtl, TTL: time.Minute},
+		})
+		require.NoError(t, err)
+
+		// Node is read along with the revision which woke the waiter.
+		res := <-readCh
+		require.NoError(t, res.err)
+		assert.GreaterOrEqual(t, res.rev, n.Revision)
+		assert.Contains(t, lo.Map(res.nodes, func(el model.Node, _ int) string { return el.ID }), n.ID)
+	}
+}